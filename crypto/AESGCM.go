@@ -0,0 +1,47 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+/*
+AESGCMEncrypt encrypts and authenticates text with AES-256-GCM.
+the key is derived by sha256, a random nonce is prepended to the result.
+additionalData is authenticated but not encrypted, it can be nil.
+*/
+func AESGCMEncrypt(key string, text, additionalData []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(text)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, text, additionalData), nil
+}
+
+// AESGCMDecrypt fails if ctext or additionalData is tampered
+func AESGCMDecrypt(key string, ctext, additionalData []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ctext) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ctext := ctext[:aead.NonceSize()], ctext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ctext, additionalData)
+}
+
+func newAESGCM(key string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(getAESKeySHA256(key))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
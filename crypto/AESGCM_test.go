@@ -0,0 +1,25 @@
+package crypto_test
+
+import (
+	"testing"
+
+	"github.com/wsva/lib_go/crypto"
+)
+
+func TestAESGCM(T *testing.T) {
+	ctext, err := crypto.AESGCMEncrypt("key", []byte("text"), []byte("ad"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	text, err := crypto.AESGCMDecrypt("key", ctext, []byte("ad"))
+	if err != nil || string(text) != "text" {
+		T.Fatalf("decrypt: %q %v", text, err)
+	}
+	if _, err := crypto.AESGCMDecrypt("key", ctext, []byte("other")); err == nil {
+		T.Error("expected error for wrong additional data")
+	}
+	ctext[len(ctext)-1] ^= 1
+	if _, err := crypto.AESGCMDecrypt("key", ctext, []byte("ad")); err == nil {
+		T.Error("expected error for tampered ciphertext")
+	}
+}
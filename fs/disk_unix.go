@@ -0,0 +1,15 @@
+//go:build !windows
+
+package fs
+
+import "syscall"
+
+// DiskFree returns the bytes available to unprivileged users on the filesystem of path
+func DiskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
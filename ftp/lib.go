@@ -1,6 +1,7 @@
 package ftp
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -52,3 +53,14 @@ func (f *FTP) WriteFile(fullpathFilename string, reader io.Reader) error {
 
 	return nil
 }
+
+// Check dials and logs in, used as a health check
+func (f *FTP) Check(ctx context.Context) error {
+	client, err := ftp.Dial(f.IP+":"+f.Port, ftp.DialWithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer client.Quit()
+
+	return client.Login(f.Username, f.Password)
+}
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const ErrorCodeValidation = "VALIDATION_FAILED"
+
+// FieldError is one failed rule of one field
+type FieldError struct {
+	// json path, like items[0].name
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is responded as ErrValidation, with FieldList in Data.List
+type ValidationError struct {
+	FieldList []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	list := make([]string, len(e.FieldList))
+	for i, v := range e.FieldList {
+		list[i] = v.Message
+	}
+	return "validation failed: " + strings.Join(list, "; ")
+}
+
+/*
+Bind decodes Request.Data into T and validates it, see Validate.
+unknown fields are rejected if strict is true.
+*/
+func Bind[T any](req *Request, strict bool) (*T, error) {
+	var result T
+	data := bytes.TrimSpace(req.Data)
+	if len(data) > 0 && !bytes.Equal(data, []byte("null")) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&result); err != nil {
+			return nil, &ValidationError{FieldList: []FieldError{{
+				Field:   "data",
+				Rule:    "json",
+				Message: err.Error(),
+			}}}
+		}
+	}
+	if err := Validate(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// BindRequest is ParseRequest followed by Bind
+func BindRequest[T any](r *http.Request, limit int64, strict bool) (*Request, *T, error) {
+	req, err := ParseRequest(r, limit)
+	if err != nil {
+		return nil, nil, ErrBadRequest.Wrap(err)
+	}
+	result, err := Bind[T](req, strict)
+	if err != nil {
+		return req, nil, err
+	}
+	return req, result, nil
+}
+
+/*
+Validate checks the "validate" struct tags of v, nested structs included.
+returns *ValidationError with all failed fields.
+
+	type User struct {
+		Name  string   `json:"name" validate:"required,min=2,max=32"`
+		Age   int      `json:"age" validate:"min=0,max=150"`
+		Role  string   `json:"role" validate:"enum=admin|user"`
+		Email string   `json:"email" validate:"regex=^[^@]+@[^@]+$"`
+		Tags  []string `json:"tags" validate:"max=10"`
+	}
+
+min and max are the value of numbers, and the length of strings, slices and maps.
+regex must be the last rule, because it may contain commas.
+fields without required are optional, other rules are skipped for their zero values.
+required rejects zero values, except 0 of numbers allowed by min, like required,min=0.
+*/
+func Validate(v any) error {
+	var fieldList []FieldError
+	validateValue(reflect.ValueOf(v), "", &fieldList)
+	if len(fieldList) > 0 {
+		return &ValidationError{FieldList: fieldList}
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, fieldList *[]FieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				fieldPath = path
+			}
+			fv := v.Field(i)
+			if tag := field.Tag.Get("validate"); tag != "" {
+				checkRules(fv, fieldPath, tag, fieldList)
+			}
+			validateValue(fv, fieldPath, fieldList)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%v[%v]", path, i), fieldList)
+		}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func splitRules(tag string) []string {
+	var result []string
+	for tag != "" {
+		tag = strings.TrimLeft(tag, " ")
+		if strings.HasPrefix(tag, "regex=") {
+			return append(result, tag)
+		}
+		rule, rest, _ := strings.Cut(tag, ",")
+		result = append(result, strings.TrimSpace(rule))
+		tag = rest
+	}
+	return result
+}
+
+// minAllowsZero is true if v is a number, and a min rule allows 0
+func minAllowsZero(v reflect.Value, rules []string) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+	default:
+		return false
+	}
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name != "min" {
+			continue
+		}
+		limit, err := strconv.ParseFloat(arg, 64)
+		return err == nil && limit <= 0
+	}
+	return false
+}
+
+var regexCache sync.Map
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if v, ok := regexCache.Load(expr); ok {
+		return v.(*regexp.Regexp), nil
+	}
+	reg, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(expr, reg)
+	return reg, nil
+}
+
+func checkRules(v reflect.Value, path, tag string, fieldList *[]FieldError) {
+	fail := func(rule, format string, args ...any) {
+		*fieldList = append(*fieldList, FieldError{
+			Field:   path,
+			Rule:    rule,
+			Message: path + " " + fmt.Sprintf(format, args...),
+		})
+	}
+	rules := splitRules(tag)
+	if v.IsZero() && !slices.Contains(rules, "required") {
+		return
+	}
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if v.IsZero() && !minAllowsZero(v, rules) {
+				fail(name, "is required")
+				return
+			}
+			continue
+		}
+		// other rules are skipped for nil pointers, use required to forbid them
+		rv := v
+		for rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				break
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() == reflect.Pointer {
+			continue
+		}
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				fail(name, "has invalid rule %v", rule)
+				continue
+			}
+			value, isLength, ok := measure(rv)
+			if !ok {
+				continue
+			}
+			if (name == "min" && value < limit) || (name == "max" && value > limit) {
+				if isLength {
+					fail(name, "length must be %v %v", minMaxWord(name), arg)
+				} else {
+					fail(name, "must be %v %v", minMaxWord(name), arg)
+				}
+			}
+		case "regex":
+			reg, err := compileRegex(arg)
+			if err != nil {
+				fail(name, "has invalid rule %v", rule)
+				continue
+			}
+			if rv.Kind() == reflect.String && !reg.MatchString(rv.String()) {
+				fail(name, "must match %v", arg)
+			}
+		case "enum":
+			value := fmt.Sprint(rv.Interface())
+			found := false
+			for _, item := range strings.Split(arg, "|") {
+				if item == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail(name, "must be one of %v", strings.ReplaceAll(arg, "|", ", "))
+			}
+		default:
+			fail(name, "has unknown rule %v", rule)
+		}
+	}
+}
+
+func minMaxWord(name string) string {
+	if name == "min" {
+		return "at least"
+	}
+	return "at most"
+}
+
+func measure(v reflect.Value) (float64, bool, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
@@ -0,0 +1,118 @@
+package http_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+type bindItem struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type bindUser struct {
+	Name  string     `json:"name" validate:"required,min=2,max=8"`
+	Age   int        `json:"age" validate:"min=0,max=150"`
+	Role  string     `json:"role" validate:"enum=admin|user"`
+	Email string     `json:"email" validate:"regex=^[a-z]{1,3},?@x$"`
+	Items []bindItem `json:"items" validate:"max=2"`
+}
+
+func TestBind(T *testing.T) {
+	req := wshttp.NewRequest("", "", bindUser{Name: "tom", Role: "user", Email: "a,@x"})
+	user, err := wshttp.Bind[bindUser](req, true)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if user.Name != "tom" {
+		T.Fatalf("wrong user: %+v", user)
+	}
+
+	req.Data = json.RawMessage(`{"name":"t","age":200,"role":"root","email":"b","items":[{}]}`)
+	_, err = wshttp.Bind[bindUser](req, false)
+	var ve *wshttp.ValidationError
+	if !errors.As(err, &ve) {
+		T.Fatalf("expect ValidationError, got %v", err)
+	}
+	fields := map[string]string{}
+	for _, v := range ve.FieldList {
+		fields[v.Field] = v.Rule
+	}
+	expect := map[string]string{"name": "min", "age": "max", "role": "enum", "email": "regex", "items[0].name": "required"}
+	for k, v := range expect {
+		if fields[k] != v {
+			T.Errorf("field %v: expect rule %v, got %v", k, v, fields[k])
+		}
+	}
+
+	req.Data = json.RawMessage(`{"name":"tom","role":"user","email":"a@x","unknown":1}`)
+	if _, err = wshttp.Bind[bindUser](req, true); err == nil {
+		T.Error("unknown field accepted")
+	}
+
+	w := httptest.NewRecorder()
+	wshttp.RespondError(w, err)
+	var resp wshttp.Response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ErrorCode != wshttp.ErrorCodeValidation || resp.Data.List == nil {
+		T.Errorf("wrong response: %s", w.Body.String())
+	}
+}
+
+type bindOptional struct {
+	Role  string `json:"role" validate:"enum=admin|user"`
+	Level int    `json:"level" validate:"min=1,max=5"`
+	Code  string `json:"code" validate:"regex=^[0-9]+$"`
+}
+
+type bindRequired struct {
+	Count int    `json:"count" validate:"required,min=0,max=5"`
+	Level int    `json:"level" validate:"required,min=1"`
+	Code  string `json:"code" validate:"required, regex=^[0-9,]+$"`
+}
+
+func TestBindRequired(T *testing.T) {
+	cases := []struct {
+		data   string
+		failed map[string]string
+	}{
+		{`{"count":0,"level":1,"code":"1,2"}`, map[string]string{}},
+		{`{"count":6,"level":0,"code":""}`, map[string]string{"count": "max", "level": "required", "code": "required"}},
+		{`{"level":2,"code":"a"}`, map[string]string{"code": "regex"}},
+	}
+	for i, c := range cases {
+		req := wshttp.NewRequest("", "", nil)
+		req.Data = json.RawMessage(c.data)
+		_, err := wshttp.Bind[bindRequired](req, true)
+		failed := map[string]string{}
+		var ve *wshttp.ValidationError
+		if errors.As(err, &ve) {
+			for _, v := range ve.FieldList {
+				failed[v.Field] = v.Rule
+			}
+		} else if err != nil {
+			T.Fatalf("case %v: %v", i, err)
+		}
+		if fmt.Sprint(failed) != fmt.Sprint(c.failed) {
+			T.Errorf("case %v: expect %v, got %v", i, c.failed, failed)
+		}
+	}
+}
+
+func TestBindOptional(T *testing.T) {
+	req := wshttp.NewRequest("", "", nil)
+	req.Data = json.RawMessage(`{}`)
+	if _, err := wshttp.Bind[bindOptional](req, true); err != nil {
+		T.Errorf("omitted optional fields: %v", err)
+	}
+	req.Data = json.RawMessage(`{"role":"root","level":9,"code":"x"}`)
+	_, err := wshttp.Bind[bindOptional](req, true)
+	var ve *wshttp.ValidationError
+	if !errors.As(err, &ve) || len(ve.FieldList) != 3 {
+		T.Errorf("invalid optional fields: %v", err)
+	}
+}
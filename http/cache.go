@@ -0,0 +1,473 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderXFromCache is set to "1" in responses served by HttpCache
+const HeaderXFromCache = "X-From-Cache"
+
+// CacheEntry is one cached response
+type CacheEntry struct {
+	StatusCode int         `json:"StatusCode"`
+	Header     http.Header `json:"Header"`
+	Body       []byte      `json:"Body"`
+
+	// request headers named by Vary
+	VaryHeader http.Header `json:"VaryHeader"`
+
+	// when the response was received or revalidated
+	StoredAt time.Time `json:"StoredAt"`
+}
+
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, e *CacheEntry) error
+	Delete(key string)
+}
+
+/*
+MemoryCacheStore keeps at most MaxEntries entries,
+the least recently used one is evicted first
+*/
+type MemoryCacheStore struct {
+	MaxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		MaxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.MoveToFront(e)
+		return e.Value.(*memoryCacheItem).entry, true
+	}
+	return nil, false
+}
+
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.MoveToFront(e)
+		e.Value.(*memoryCacheItem).entry = entry
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if s.MaxEntries > 0 && s.ll.Len() > s.MaxEntries {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// DiskCacheStore keeps one json file per entry in Dir
+type DiskCacheStore struct {
+	Dir string
+}
+
+func (s *DiskCacheStore) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *DiskCacheStore) Get(key string) (*CacheEntry, bool) {
+	contentBytes, err := os.ReadFile(s.filename(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(contentBytes, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Set writes a temp file and renames it, so readers never see half a file
+func (s *DiskCacheStore) Set(key string, entry *CacheEntry) error {
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.Dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(jsonBytes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.filename(key))
+}
+
+func (s *DiskCacheStore) Delete(key string) {
+	os.Remove(s.filename(key))
+}
+
+/*
+HttpCache is a private RFC 7234 style cache for GET requests.
+
+it honors Cache-Control (max-age, no-cache, no-store, must-revalidate,
+stale-while-revalidate), Expires, ETag/If-None-Match and
+Last-Modified/If-Modified-Since. fresh responses are served from Store,
+stale ones are revalidated, or served while revalidating in background
+inside the stale-while-revalidate window.
+
+	client := HttpClient{Address: url, Method: http.MethodGet, Cache: NewMemoryCache(100)}
+*/
+type HttpCache struct {
+	Store CacheStore
+
+	// larger responses are not stored, default 10MB
+	MaxBodyBytes int64
+
+	// timeout of background revalidation, default 30s
+	RevalidateTimeout time.Duration
+
+	mu         sync.Mutex
+	revalidate map[string]bool
+	now        func() time.Time
+}
+
+func NewMemoryCache(maxEntries int) *HttpCache {
+	return &HttpCache{Store: NewMemoryCacheStore(maxEntries)}
+}
+
+func NewDiskCache(dir string) *HttpCache {
+	return &HttpCache{Store: &DiskCacheStore{Dir: dir}}
+}
+
+// Wrap returns a RoundTripper caching the responses of base
+func (c *HttpCache) Wrap(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cacheTransport{cache: c, base: base}
+}
+
+func (c *HttpCache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+type cacheTransport struct {
+	cache *HttpCache
+	base  http.RoundTripper
+}
+
+func parseCacheControl(h http.Header) map[string]string {
+	result := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if key == "" {
+				continue
+			}
+			result[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return result
+}
+
+func cacheKey(r *http.Request) string {
+	return r.Method + " " + r.URL.String()
+}
+
+func (t *cacheTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+		return t.base.RoundTrip(r)
+	}
+	reqCC := parseCacheControl(r.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return t.base.RoundTrip(r)
+	}
+
+	key := cacheKey(r)
+	entry, ok := t.cache.Store.Get(key)
+	if ok && !entry.matchVary(r) {
+		ok = false
+	}
+	if !ok {
+		return t.fetch(r, key, nil)
+	}
+
+	now := t.cache.timeNow()
+	respCC := parseCacheControl(entry.Header)
+	_, reqNoCache := reqCC["no-cache"]
+	_, respNoCache := respCC["no-cache"]
+	age := entry.age(now)
+	lifetime := entry.freshnessLifetime()
+	if !reqNoCache && !respNoCache && age < lifetime {
+		return entry.response(r), nil
+	}
+
+	_, mustRevalidate := respCC["must-revalidate"]
+	if swr, err := strconv.Atoi(respCC["stale-while-revalidate"]); err == nil &&
+		!reqNoCache && !respNoCache && !mustRevalidate &&
+		age < lifetime+time.Duration(swr)*time.Second {
+		t.revalidateInBackground(r, key, entry)
+		return entry.response(r), nil
+	}
+	return t.fetch(r, key, entry)
+}
+
+func (t *cacheTransport) revalidateInBackground(r *http.Request, key string, entry *CacheEntry) {
+	c := t.cache
+	c.mu.Lock()
+	if c.revalidate == nil {
+		c.revalidate = make(map[string]bool)
+	}
+	if c.revalidate[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidate[key] = true
+	c.mu.Unlock()
+
+	timeout := c.RevalidateTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	// the original request may be canceled when its response is done
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+	req := r.Clone(ctx)
+	go func() {
+		defer cancel()
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidate, key)
+			c.mu.Unlock()
+		}()
+		resp, err := t.fetch(req, key, entry)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+}
+
+// fetch sends r, conditional if entry is not nil, and stores the response
+func (t *cacheTransport) fetch(r *http.Request, key string, entry *CacheEntry) (*http.Response, error) {
+	req := r
+	if entry != nil {
+		etag := entry.Header.Get("ETag")
+		lastModified := entry.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			req = r.Clone(r.Context())
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	sentAt := t.cache.timeNow()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		// 304 updates the stored headers, entry may be in use by others
+		updated := *entry
+		updated.Header = entry.Header.Clone()
+		for k, v := range resp.Header {
+			updated.Header[k] = v
+		}
+		updated.StoredAt = sentAt
+		t.cache.Store.Set(key, &updated)
+		return updated.response(r), nil
+	}
+	if !isCacheable(resp) {
+		if entry != nil {
+			t.cache.Store.Delete(key)
+		}
+		return resp, nil
+	}
+
+	limit := t.cache.MaxBodyBytes
+	if limit <= 0 {
+		limit = 10 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		// too large, stream the rest without caching
+		if entry != nil {
+			t.cache.Store.Delete(key)
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	newEntry := &CacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   sentAt,
+		VaryHeader: make(http.Header),
+	}
+	for _, v := range varyHeaders(resp.Header) {
+		newEntry.VaryHeader[v] = r.Header.Values(v)
+	}
+	t.cache.Store.Set(key, newEntry)
+	return resp, nil
+}
+
+func isCacheable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	for _, v := range varyHeaders(resp.Header) {
+		if v == "*" {
+			return false
+		}
+	}
+	_, hasMaxAge := cc["max-age"]
+	_, hasNoCache := cc["no-cache"]
+	return hasMaxAge || hasNoCache ||
+		resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+func varyHeaders(h http.Header) []string {
+	var result []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				result = append(result, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return result
+}
+
+func (e *CacheEntry) matchVary(r *http.Request) bool {
+	for _, name := range varyHeaders(e.Header) {
+		if strings.Join(r.Header.Values(name), ",") != strings.Join(e.VaryHeader[name], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *CacheEntry) age(now time.Time) time.Duration {
+	age := now.Sub(e.StoredAt)
+	if v, err := strconv.Atoi(e.Header.Get("Age")); err == nil && v > 0 {
+		age += time.Duration(v) * time.Second
+	}
+	return age
+}
+
+func (e *CacheEntry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if v, ok := cc["max-age"]; ok {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.StoredAt
+	}
+	if v := e.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	// heuristic freshness, 10% of the time since last modified
+	if v := e.Header.Get("Last-Modified"); v != "" {
+		lastModified, err := http.ParseTime(v)
+		if err == nil && date.After(lastModified) {
+			return date.Sub(lastModified) / 10
+		}
+	}
+	return 0
+}
+
+func (e *CacheEntry) response(r *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Set(HeaderXFromCache, "1")
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
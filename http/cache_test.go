@@ -0,0 +1,145 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHttpCache(T *testing.T) {
+	var hits, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/swr":
+			w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	now := time.Unix(1000, 0)
+	for _, cache := range []*HttpCache{NewMemoryCache(10), NewDiskCache(T.TempDir())} {
+		cache.now = func() time.Time { return now }
+		client := &http.Client{Transport: cache.Wrap(nil)}
+		get := func(path string) (string, bool) {
+			resp, err := client.Get(server.URL + path)
+			if err != nil {
+				T.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			return string(body), resp.Header.Get(HeaderXFromCache) == "1"
+		}
+		hits.Store(0)
+		notModified.Store(0)
+
+		get("/fresh")
+		if body, cached := get("/fresh"); !cached || body != "/fresh" || hits.Load() != 1 {
+			T.Fatalf("fresh response not cached: %v %v %v", body, cached, hits.Load())
+		}
+
+		// no max-age, revalidated with ETag every time
+		get("/etag")
+		if body, _ := get("/etag"); body != "/etag" || notModified.Load() != 1 {
+			T.Fatalf("not revalidated: %v %v", body, notModified.Load())
+		}
+
+		get("/nostore")
+		if _, cached := get("/nostore"); cached {
+			T.Fatal("no-store cached")
+		}
+
+		get("/swr")
+		now = now.Add(10 * time.Second)
+		hits.Store(0)
+		if body, cached := get("/swr"); !cached || body != "/swr" {
+			T.Fatalf("stale response not served: %v %v", body, cached)
+		}
+		for i := 0; i < 100 && hits.Load() == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if hits.Load() != 1 {
+			T.Fatal("not revalidated in background")
+		}
+	}
+}
+
+func TestHttpCacheRevalidate(T *testing.T) {
+	var large, stall atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if stall.Load() {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		if large.Load() {
+			fmt.Fprint(w, strings.Repeat("x", 100))
+			return
+		}
+		fmt.Fprint(w, "small")
+	}))
+	defer server.Close()
+
+	now := time.Unix(1000, 0)
+	cache := NewMemoryCache(10)
+	cache.MaxBodyBytes = 10
+	cache.RevalidateTimeout = 50 * time.Millisecond
+	cache.now = func() time.Time { return now }
+	client := &http.Client{Transport: cache.Wrap(nil)}
+	get := func() {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			T.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	cached := func() bool {
+		_, ok := cache.Store.Get(cacheKey(httptest.NewRequest(http.MethodGet, server.URL, nil)))
+		return ok
+	}
+	revalidating := func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return len(cache.revalidate) > 0
+	}
+
+	// a stalled origin does not block revalidation forever
+	get()
+	stall.Store(true)
+	now = now.Add(10 * time.Second)
+	get()
+	for i := 0; i < 100 && revalidating(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if revalidating() {
+		T.Fatal("background revalidation not timed out")
+	}
+
+	// a response too large to store removes the old one
+	stall.Store(false)
+	large.Store(true)
+	get()
+	for i := 0; i < 100 && (revalidating() || cached()); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cached() {
+		T.Fatal("old entry kept after too large response")
+	}
+}
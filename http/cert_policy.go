@@ -0,0 +1,234 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// CertIdentity is the authenticated client certificate of a mutual https request
+type CertIdentity struct {
+	CommonName          string
+	OrganizationalUnits []string
+	DNSNames            []string
+	URIs                []string
+
+	// sha256 of the verified issuer certificate in lowercase hex
+	IssuerFingerprint string
+
+	Certificate *x509.Certificate
+}
+
+/*
+NewCertIdentity returns nil if the request has no verified certificate chain,
+certificates sent by the client but not verified are never trusted.
+*/
+func NewCertIdentity(r *http.Request) *CertIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	chain := r.TLS.VerifiedChains[0]
+	cert := chain[0]
+	id := &CertIdentity{
+		CommonName:          strings.ReplaceAll(cert.Subject.CommonName, "CN=", ""),
+		OrganizationalUnits: cert.Subject.OrganizationalUnit,
+		DNSNames:            cert.DNSNames,
+		Certificate:         cert,
+	}
+	for _, v := range cert.URIs {
+		id.URIs = append(id.URIs, v.String())
+	}
+	// a self-signed certificate trusted directly has no issuer in the chain
+	if len(chain) > 1 {
+		sum := sha256.Sum256(chain[1].Raw)
+		id.IssuerFingerprint = hex.EncodeToString(sum[:])
+	}
+	return id
+}
+
+// GetCertIdentity returns the identity set by CertPolicy, or nil
+func GetCertIdentity(r *http.Request) *CertIdentity {
+	id, _ := r.Context().Value(contextKeyCertIdentity).(*CertIdentity)
+	return id
+}
+
+/*
+CertRule authorizes requests matching Path and Methods.
+
+every non-empty Allow* field must match, any item of a field is enough.
+CommonNames, DNSNames and URIs are path.Match patterns, like *.example.com
+*/
+type CertRule struct {
+	// path prefix matched by segments, "/admin" matches "/admin/x" but not "/administrator".
+	// the longest match wins, empty matches all
+	Path string `json:"Path"`
+
+	// empty matches all methods
+	Methods []string `json:"Methods"`
+
+	AllowCommonNames         []string `json:"AllowCommonNames"`
+	AllowOrganizationalUnits []string `json:"AllowOrganizationalUnits"`
+	AllowDNSNames            []string `json:"AllowDNSNames"`
+	AllowURIs                []string `json:"AllowURIs"`
+
+	// sha256 of issuer certificate in hex, colons are ignored
+	AllowIssuerFingerprints []string `json:"AllowIssuerFingerprints"`
+}
+
+func (c *CertRule) matchRoute(r *http.Request) bool {
+	if !matchPathPrefix(c.Path, r.URL.Path) {
+		return false
+	}
+	if len(c.Methods) == 0 {
+		return true
+	}
+	for _, v := range c.Methods {
+		if strings.EqualFold(v, r.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPathPrefix(prefix, p string) bool {
+	if prefix == "" || prefix == p {
+		return true
+	}
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return strings.HasSuffix(prefix, "/") || p[len(prefix)] == '/'
+}
+
+func (c *CertRule) Allow(id *CertIdentity) bool {
+	if id == nil {
+		return false
+	}
+	if len(c.AllowCommonNames) > 0 &&
+		!matchAnyPattern(c.AllowCommonNames, []string{id.CommonName}) {
+		return false
+	}
+	if len(c.AllowOrganizationalUnits) > 0 &&
+		!matchAnyPattern(c.AllowOrganizationalUnits, id.OrganizationalUnits) {
+		return false
+	}
+	if len(c.AllowDNSNames) > 0 &&
+		!matchAnyPattern(c.AllowDNSNames, id.DNSNames) {
+		return false
+	}
+	if len(c.AllowURIs) > 0 &&
+		!matchAnyPattern(c.AllowURIs, id.URIs) {
+		return false
+	}
+	if len(c.AllowIssuerFingerprints) > 0 {
+		if id.IssuerFingerprint == "" {
+			return false
+		}
+		found := false
+		for _, v := range c.AllowIssuerFingerprints {
+			v = strings.ToLower(strings.ReplaceAll(v, ":", ""))
+			if v == id.IssuerFingerprint {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAnyPattern(patterns, values []string) bool {
+	for _, p := range patterns {
+		for _, v := range values {
+			if ok, _ := path.Match(p, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+CertPolicy holds per-route CertRule.
+requests matching no rule are denied.
+
+	{
+	  "Rules": [
+	    {"Path": "/", "AllowOrganizationalUnits": ["ops"]},
+	    {"Path": "/admin/", "Methods": ["POST"], "AllowCommonNames": ["admin-*"]}
+	  ]
+	}
+*/
+type CertPolicy struct {
+	Rules []CertRule `json:"Rules"`
+}
+
+func LoadCertPolicy(filename string) (*CertPolicy, error) {
+	contentBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p CertPolicy
+	err = json.Unmarshal(contentBytes, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *CertPolicy) matchRule(r *http.Request) *CertRule {
+	var matched *CertRule
+	for i, v := range p.Rules {
+		if !v.matchRoute(r) {
+			continue
+		}
+		if matched == nil || len(v.Path) > len(matched.Path) {
+			matched = &p.Rules[i]
+		}
+	}
+	return matched
+}
+
+var (
+	ErrNoClientCert      = RegisterError("CERT_REQUIRED", http.StatusUnauthorized, "no certificate found", ShowTypeError)
+	ErrCertNotAuthorized = RegisterError("CERT_FORBIDDEN", http.StatusForbidden, "certificate not authorized", ShowTypeError)
+)
+
+// Authorize returns the identity if the certificate is allowed by the matched rule
+func (p *CertPolicy) Authorize(r *http.Request) (*CertIdentity, error) {
+	id := NewCertIdentity(r)
+	if id == nil {
+		return nil, ErrNoClientCert
+	}
+	rule := p.matchRule(r)
+	if rule == nil || !rule.Allow(id) {
+		return id, ErrCertNotAuthorized
+	}
+	return id, nil
+}
+
+/*
+Middleware responds 401 without verified certificate, 403 if not authorized,
+otherwise puts CertIdentity into the request context, see GetCertIdentity
+*/
+func (p *CertPolicy) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := p.Authorize(r)
+			if err != nil {
+				RespondError(w, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), contextKeyCertIdentity, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func newTestCert(T *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		T.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		T.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return cert, key
+}
+
+func newTestCA(T *testing.T, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	return newTestCert(T, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+}
+
+// verifiedState returns the state of a handshake verifying leaf with ca
+func verifiedState(T *testing.T, leaf, ca *x509.Certificate) *tls.ConnectionState {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+	return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}, VerifiedChains: chains}
+}
+
+func TestCertPolicy(T *testing.T) {
+	ca, caKey := newTestCA(T, "ca")
+	otherCA, otherKey := newTestCA(T, "other")
+	sum := sha256.Sum256(ca.Raw)
+	spiffe, _ := url.Parse("spiffe://example.org/ops")
+	template := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject: pkix.Name{
+				CommonName:         "admin-1",
+				OrganizationalUnit: []string{"ops"},
+			},
+			DNSNames:    []string{"a.example.com"},
+			URIs:        []*url.URL{spiffe},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+	}
+	cert, _ := newTestCert(T, template(), ca, caKey)
+	otherCert, _ := newTestCert(T, template(), otherCA, otherKey)
+
+	policy := &wshttp.CertPolicy{
+		Rules: []wshttp.CertRule{
+			{Path: "/", AllowOrganizationalUnits: []string{"ops"}},
+			{Path: "/admin/", Methods: []string{"POST"},
+				AllowCommonNames:        []string{"admin-*"},
+				AllowDNSNames:           []string{"*.example.com"},
+				AllowURIs:               []string{"spiffe://example.org/*"},
+				AllowIssuerFingerprints: []string{hex.EncodeToString(sum[:])}},
+			{Path: "/root", AllowCommonNames: []string{"root"}},
+		},
+	}
+
+	var seen string
+	handler := policy.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = wshttp.GetCertIdentity(r).CommonName
+	}))
+
+	verified := verifiedState(T, cert, ca)
+	// a client can send the public CA certificate after any leaf
+	unverified := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{otherCert, ca}}
+	cases := []struct {
+		method, path string
+		state        *tls.ConnectionState
+		expect       int
+	}{
+		{http.MethodGet, "/x", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/x", unverified, http.StatusUnauthorized},
+		{http.MethodPost, "/admin/x", unverified, http.StatusUnauthorized},
+		{http.MethodGet, "/x", verified, http.StatusOK},
+		{http.MethodPost, "/admin/x", verified, http.StatusOK},
+		{http.MethodPost, "/admin/x", verifiedState(T, otherCert, otherCA), http.StatusForbidden},
+		{http.MethodGet, "/root", verified, http.StatusForbidden},
+		{http.MethodGet, "/root/x", verified, http.StatusForbidden},
+		{http.MethodGet, "/rootkit", verified, http.StatusOK},
+	}
+	for i, v := range cases {
+		r := httptest.NewRequest(v.method, v.path, nil)
+		r.TLS = v.state
+		w := httptest.NewRecorder()
+		seen = ""
+		handler.ServeHTTP(w, r)
+		if w.Code != v.expect {
+			T.Errorf("case %v: expect %v, got %v", i, v.expect, w.Code)
+		}
+		if v.expect == http.StatusOK && seen != "admin-1" {
+			T.Errorf("case %v: identity not in context", i)
+		}
+	}
+}
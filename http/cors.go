@@ -0,0 +1,94 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CORSConfig struct {
+	// "*" allows all origins, but is ignored if AllowCredentials is true,
+	// credentialed requests are only allowed from origins listed explicitly
+	AllowOrigins     []string `json:"AllowOrigins"`
+	AllowMethods     []string `json:"AllowMethods"`
+	AllowHeaders     []string `json:"AllowHeaders"`
+	ExposeHeaders    []string `json:"ExposeHeaders"`
+	AllowCredentials bool     `json:"AllowCredentials"`
+
+	// seconds, 0 means not set
+	MaxAge int `json:"MaxAge"`
+}
+
+func DefaultCORSConfig() *CORSConfig {
+	return &CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodHead,
+		},
+		AllowHeaders: []string{"Content-Type", "Authorization", HeaderRequestID},
+	}
+}
+
+func (c *CORSConfig) allowOrigin(origin string) bool {
+	for _, v := range c.AllowOrigins {
+		if (v == "*" && !c.AllowCredentials) || strings.EqualFold(v, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+CORS sets the Access-Control-* headers for allowed origins,
+and answers preflight requests with 204
+*/
+func CORS(c *CORSConfig) Middleware {
+	if c == nil {
+		c = DefaultCORSConfig()
+	}
+	allowMethods := strings.Join(c.AllowMethods, ", ")
+	allowHeaders := strings.Join(c.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(c.ExposeHeaders, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !c.allowOrigin(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h.Set("Access-Control-Allow-Origin", origin)
+			if c.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method == http.MethodOptions &&
+				r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", allowMethods)
+				if allowHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", allowHeaders)
+				}
+				if c.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ShowType of Response, see https://pro.ant.design/zh-CN/docs/request
+const (
+	ShowTypeSilent       = 0
+	ShowTypeWarn         = 1
+	ShowTypeError        = 2
+	ShowTypeNotification = 4
+	ShowTypePage         = 9
+)
+
+/*
+APIError is responded by RespondError with its Status, Code, Message and ShowType.
+Cause is for logs only, and is never responded.
+
+	var ErrUserNotFound = RegisterError("USER_NOT_FOUND", http.StatusNotFound, "user not found", ShowTypeError)
+
+	return ErrUserNotFound.Wrap(err)
+*/
+type APIError struct {
+	Code     string
+	Status   int
+	Message  string
+	ShowType int
+	Cause    error
+}
+
+func (e *APIError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%v: %v: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%v: %v", e.Code, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches any APIError with the same Code
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e with cause
+func (e *APIError) Wrap(cause error) *APIError {
+	c := *e
+	c.Cause = cause
+	return &c
+}
+
+// WithMessage returns a copy of e with message
+func (e *APIError) WithMessage(format string, args ...any) *APIError {
+	c := *e
+	c.Message = fmt.Sprintf(format, args...)
+	return &c
+}
+
+var (
+	catalogLock sync.RWMutex
+	catalog     = make(map[string]*APIError)
+)
+
+// RegisterError adds a code to the catalog, it panics if code is registered
+func RegisterError(code string, status int, message string, showType int) *APIError {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if _, ok := catalog[code]; ok {
+		panic(fmt.Sprintf("error code already registered: %v", code))
+	}
+	e := &APIError{
+		Code:     code,
+		Status:   status,
+		Message:  message,
+		ShowType: showType,
+	}
+	catalog[code] = e
+	return e
+}
+
+func LookupError(code string) (*APIError, bool) {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	e, ok := catalog[code]
+	return e, ok
+}
+
+// ErrorCatalog returns all registered errors sorted by code, useful for docs
+func ErrorCatalog() []*APIError {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	result := make([]*APIError, 0, len(catalog))
+	for _, v := range catalog {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
+	return result
+}
+
+var (
+	ErrBadRequest       = RegisterError("BAD_REQUEST", http.StatusBadRequest, "bad request", ShowTypeError)
+	ErrValidation       = RegisterError(ErrorCodeValidation, http.StatusBadRequest, "validation failed", ShowTypeError)
+	ErrUnauthorized     = RegisterError("UNAUTHORIZED", http.StatusUnauthorized, "unauthorized", ShowTypeError)
+	ErrForbidden        = RegisterError("FORBIDDEN", http.StatusForbidden, "forbidden", ShowTypeError)
+	ErrNotFound         = RegisterError("NOT_FOUND", http.StatusNotFound, "not found", ShowTypeError)
+	ErrMethodNotAllowed = RegisterError("METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed, "method not allowed", ShowTypeError)
+	ErrTooManyRequests  = RegisterError("TOO_MANY_REQUESTS", http.StatusTooManyRequests, "too many requests", ShowTypeWarn)
+	ErrInternal         = RegisterError("INTERNAL_ERROR", http.StatusInternalServerError, "internal server error", ShowTypeError)
+)
+
+/*
+NewErrorResponse returns the Response and http status of err.
+
+an *APIError anywhere in the chain of err sets Status, ErrorCode, ErrMsg
+and ShowType, its Cause is hidden. a *ValidationError sets the list of
+FieldError in Data.List. other errors are responded as before, with
+status 200 and ErrMsg of fmt.Sprint(err), so wrap internal causes
+with ErrInternal to hide them.
+*/
+func NewErrorResponse(err any) (*Response, int) {
+	resp := &Response{
+		Success: false,
+		ErrMsg:  fmt.Sprint(err),
+	}
+	status := http.StatusOK
+	e, ok := err.(error)
+	if !ok {
+		return resp, status
+	}
+	var ve *ValidationError
+	if errors.As(e, &ve) {
+		resp.Data.List = ve.FieldList
+		resp.ErrMsg = ve.Error()
+		resp.ErrorCode = ErrValidation.Code
+		resp.ShowType = ErrValidation.ShowType
+		status = ErrValidation.Status
+	}
+	var ae *APIError
+	if errors.As(e, &ae) {
+		resp.ErrMsg = ae.Message
+		resp.ErrorCode = ae.Code
+		resp.ShowType = ae.ShowType
+		status = ae.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+	}
+	return resp, status
+}
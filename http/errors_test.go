@@ -0,0 +1,67 @@
+package http_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+var errTestNotFound = wshttp.RegisterError("TEST_NOT_FOUND", http.StatusNotFound, "user not found", wshttp.ShowTypeNotification)
+
+func TestRespondError(T *testing.T) {
+	cause := errors.New("sql: no rows in result set")
+	err := fmt.Errorf("get user: %w", errTestNotFound.Wrap(cause))
+	if !errors.Is(err, errTestNotFound) || !errors.Is(err, cause) {
+		T.Fatal("errors.Is failed")
+	}
+
+	w := httptest.NewRecorder()
+	wshttp.RespondError(w, err)
+	var resp wshttp.Response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusNotFound ||
+		resp.ErrorCode != "TEST_NOT_FOUND" ||
+		resp.ErrMsg != "user not found" ||
+		resp.ShowType != wshttp.ShowTypeNotification {
+		T.Fatalf("wrong response: %v %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	wshttp.RespondError(w, wshttp.ErrInternal.Wrap(errors.New("dial tcp 10.0.0.1:5432: refused")))
+	resp = wshttp.Response{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusInternalServerError || resp.ErrorCode != wshttp.ErrInternal.Code ||
+		strings.Contains(w.Body.String(), "10.0.0.1") {
+		T.Fatalf("internal error leaked: %v %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	wshttp.RespondError(w, errors.New("plain error"))
+	resp = wshttp.Response{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.ErrMsg != "plain error" || resp.ErrorCode != "" {
+		T.Fatalf("plain error changed: %v %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	wshttp.RespondError(w, "plain")
+	if w.Code != http.StatusOK {
+		T.Fatalf("plain error changed status: %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	wshttp.RespondErrorStatus(w, http.StatusConflict, errTestNotFound)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "TEST_NOT_FOUND") {
+		T.Fatalf("wrong status response: %v %s", w.Code, w.Body.String())
+	}
+
+	if e, ok := wshttp.LookupError("TEST_NOT_FOUND"); !ok || e != errTestNotFound {
+		T.Fatal("not in catalog")
+	}
+}
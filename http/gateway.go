@@ -0,0 +1,386 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceLeastConn  = "least-conn"
+)
+
+/*
+GatewayConfig is the json config of Gateway
+
+	{
+	  "Routes": [
+	    {
+	      "PathPrefix": "/api/user/",
+	      "RewritePrefix": "/",
+	      "Upstreams": ["https://10.0.0.1:8443", "https://10.0.0.2:8443"],
+	      "Balance": "least-conn",
+	      "HealthCheck": {"Path": "/healthz", "Interval": 5},
+	      "CACrtFile": "ca.crt",
+	      "ClientCrtFile": "gateway.crt",
+	      "ClientKeyFile": "gateway.key"
+	    }
+	  ]
+	}
+*/
+type GatewayConfig struct {
+	Routes []GatewayRoute `json:"Routes"`
+}
+
+type GatewayRoute struct {
+	// empty matches all hosts, port is ignored
+	Host string `json:"Host"`
+
+	// matched by segments, "/svc" matches "/svc/x" but not "/svcadmin".
+	// the longest match wins
+	PathPrefix string `json:"PathPrefix"`
+
+	// replaces PathPrefix when forwarding, PathPrefix is kept if empty
+	RewritePrefix string `json:"RewritePrefix"`
+
+	// base urls, like https://10.0.0.1:8443/base
+	Upstreams []string `json:"Upstreams"`
+
+	// BalanceRoundRobin (default) or BalanceLeastConn
+	Balance string `json:"Balance"`
+
+	// active health check is disabled if nil
+	HealthCheck *HealthCheckConfig `json:"HealthCheck"`
+
+	// used to verify https upstreams, system roots if empty
+	CACrtFile  string `json:"CACrtFile"`
+	SkipVerify bool   `json:"SkipVerify"`
+
+	// client certificate for mutual https upstreams
+	ClientCrtFile string `json:"ClientCrtFile"`
+	ClientKeyFile string `json:"ClientKeyFile"`
+}
+
+type HealthCheckConfig struct {
+	Path     string        `json:"Path"`
+	Interval time.Duration `json:"Interval"` // second
+	// default 5
+	Timeout time.Duration `json:"Timeout"` // second
+
+	// consecutive results to change state, default 2 and 1
+	UnhealthyThreshold int `json:"UnhealthyThreshold"`
+	HealthyThreshold   int `json:"HealthyThreshold"`
+}
+
+func LoadGatewayConfig(filename string) (*GatewayConfig, error) {
+	contentBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config GatewayConfig
+	err = json.Unmarshal(contentBytes, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+var (
+	ErrBadGateway         = RegisterError("BAD_GATEWAY", http.StatusBadGateway, "bad gateway", ShowTypeError)
+	ErrServiceUnavailable = RegisterError("SERVICE_UNAVAILABLE", http.StatusServiceUnavailable, "no healthy upstream", ShowTypeError)
+)
+
+type upstream struct {
+	url     *url.URL
+	healthy atomic.Bool
+	conns   atomic.Int64
+
+	// consecutive health check results, used by the checker only
+	successes int
+	failures  int
+}
+
+type gatewayRoute struct {
+	config    GatewayRoute
+	upstreams []*upstream
+	next      atomic.Uint64
+	transport *http.Transport
+	proxy     *httputil.ReverseProxy
+}
+
+type contextKeyUpstream struct{}
+
+/*
+Gateway is a reverse proxy with multiple upstreams per route.
+
+X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto are set,
+and WebSocket upgrades are passed through.
+requests matching no route get ErrNotFound.
+*/
+type Gateway struct {
+	routes []*gatewayRoute
+	once   sync.Once
+}
+
+func NewGateway(config *GatewayConfig) (*Gateway, error) {
+	g := &Gateway{}
+	for i, v := range config.Routes {
+		route, err := newGatewayRoute(v)
+		if err != nil {
+			return nil, fmt.Errorf("route[%d]: %w", i, err)
+		}
+		g.routes = append(g.routes, route)
+	}
+	return g, nil
+}
+
+func newUpstreamTLSConfig(c *GatewayRoute) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.SkipVerify,
+	}
+	if c.CACrtFile != "" {
+		caPool := x509.NewCertPool()
+		crt, err := os.ReadFile(c.CACrtFile)
+		if err != nil {
+			return nil, err
+		}
+		caPool.AppendCertsFromPEM(crt)
+		config.RootCAs = caPool
+	}
+	if c.ClientCrtFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCrtFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func newGatewayRoute(c GatewayRoute) (*gatewayRoute, error) {
+	if len(c.Upstreams) == 0 {
+		return nil, errors.New("no upstream")
+	}
+	switch c.Balance {
+	case "":
+		c.Balance = BalanceRoundRobin
+	case BalanceRoundRobin, BalanceLeastConn:
+	default:
+		return nil, fmt.Errorf("unsupported balance: %v", c.Balance)
+	}
+	tlsConfig, err := newUpstreamTLSConfig(&c)
+	if err != nil {
+		return nil, err
+	}
+	route := &gatewayRoute{
+		config: c,
+		transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       tlsConfig,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+	for _, v := range c.Upstreams {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported upstream: %v", v)
+		}
+		up := &upstream{url: u}
+		up.healthy.Store(true)
+		route.upstreams = append(route.upstreams, up)
+	}
+	route.proxy = &httputil.ReverseProxy{
+		Transport: route.transport,
+		Rewrite:   route.rewrite,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			RespondError(w, ErrBadGateway.Wrap(err))
+		},
+		// flush immediately for streaming, like SSE
+		FlushInterval: -1,
+	}
+	return route, nil
+}
+
+func (r *gatewayRoute) rewrite(pr *httputil.ProxyRequest) {
+	up := pr.In.Context().Value(contextKeyUpstream{}).(*upstream)
+	if r.config.RewritePrefix != "" {
+		rest := strings.TrimPrefix(pr.In.URL.Path, r.config.PathPrefix)
+		pr.Out.URL.Path = strings.TrimSuffix(r.config.RewritePrefix, "/") + "/" + strings.TrimPrefix(rest, "/")
+		pr.Out.URL.RawPath = ""
+	}
+	pr.SetURL(up.url)
+	pr.SetXForwarded()
+}
+
+func (r *gatewayRoute) pick() *upstream {
+	var healthy []*upstream
+	for _, v := range r.upstreams {
+		if v.healthy.Load() {
+			healthy = append(healthy, v)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	if r.config.Balance == BalanceLeastConn {
+		best := healthy[0]
+		for _, v := range healthy[1:] {
+			if v.conns.Load() < best.conns.Load() {
+				best = v
+			}
+		}
+		return best
+	}
+	return healthy[(r.next.Add(1)-1)%uint64(len(healthy))]
+}
+
+func (r *gatewayRoute) match(req *http.Request) bool {
+	if r.config.Host != "" {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.EqualFold(host, r.config.Host) {
+			return false
+		}
+	}
+	return matchPathPrefix(r.config.PathPrefix, req.URL.Path)
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var matched *gatewayRoute
+	for _, v := range g.routes {
+		if !v.match(req) {
+			continue
+		}
+		if matched == nil || len(v.config.PathPrefix) > len(matched.config.PathPrefix) {
+			matched = v
+		}
+	}
+	if matched == nil {
+		RespondError(w, ErrNotFound)
+		return
+	}
+	up := matched.pick()
+	if up == nil {
+		RespondError(w, ErrServiceUnavailable)
+		return
+	}
+	up.conns.Add(1)
+	defer up.conns.Add(-1)
+	ctx := context.WithValue(req.Context(), contextKeyUpstream{}, up)
+	matched.proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+/*
+StartHealthCheck runs the active health checks of all routes until ctx is done.
+upstreams are healthy until checked.
+*/
+func (g *Gateway) StartHealthCheck(ctx context.Context) {
+	g.once.Do(func() {
+		for _, v := range g.routes {
+			if v.config.HealthCheck != nil && v.config.HealthCheck.Interval > 0 {
+				go v.healthCheckLoop(ctx)
+			}
+		}
+	})
+}
+
+func (r *gatewayRoute) healthCheckLoop(ctx context.Context) {
+	hc := r.config.HealthCheck
+	timeout := hc.Timeout
+	if timeout == 0 {
+		timeout = 5
+	}
+	client := &http.Client{
+		Transport: r.transport,
+		Timeout:   timeout * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	ticker := time.NewTicker(hc.Interval * time.Second)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, v := range r.upstreams {
+			wg.Add(1)
+			go func(up *upstream) {
+				defer wg.Done()
+				r.checkUpstream(ctx, client, up)
+			}(v)
+		}
+		wg.Wait()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *gatewayRoute) checkUpstream(ctx context.Context, client *http.Client, up *upstream) {
+	hc := r.config.HealthCheck
+	unhealthyThreshold := hc.UnhealthyThreshold
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = 2
+	}
+	healthyThreshold := hc.HealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = 1
+	}
+
+	ok := false
+	u := *up.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(hc.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err == nil {
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			ok = resp.StatusCode >= 200 && resp.StatusCode < 400
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if ok {
+		up.failures = 0
+		up.successes++
+		if up.successes >= healthyThreshold {
+			up.healthy.Store(true)
+		}
+	} else {
+		up.successes = 0
+		up.failures++
+		if up.failures >= unhealthyThreshold {
+			up.healthy.Store(false)
+		}
+	}
+}
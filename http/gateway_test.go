@@ -0,0 +1,136 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestGateway(T *testing.T) {
+	var down atomic.Bool
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" {
+				if name == "b" && down.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			fmt.Fprintf(w, "%v %v %v", name, r.URL.Path, r.Header.Get("X-Forwarded-For"))
+		}))
+	}
+	a, b := newUpstream("a"), newUpstream("b")
+	defer a.Close()
+	defer b.Close()
+
+	gateway, err := wshttp.NewGateway(&wshttp.GatewayConfig{
+		Routes: []wshttp.GatewayRoute{{
+			PathPrefix:    "/api/",
+			RewritePrefix: "/v1/",
+			Upstreams:     []string{a.URL, b.URL},
+			HealthCheck: &wshttp.HealthCheckConfig{
+				Path:               "/healthz",
+				Interval:           1,
+				UnhealthyThreshold: 1,
+			},
+		}, {
+			PathPrefix: "/svc",
+			Upstreams:  []string{a.URL},
+		}},
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gateway.StartHealthCheck(ctx)
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			T.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		_, body := get("/api/users")
+		seen[body] = true
+	}
+	if !seen["a /v1/users 127.0.0.1"] || !seen["b /v1/users 127.0.0.1"] {
+		T.Fatalf("not balanced: %v", seen)
+	}
+
+	down.Store(true)
+	time.Sleep(1200 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, body := get("/api/users"); body[0] != 'a' {
+			T.Fatalf("unhealthy upstream used: %v", body)
+		}
+	}
+
+	if code, _ := get("/other"); code != http.StatusNotFound {
+		T.Fatalf("wrong status: %v", code)
+	}
+	if _, body := get("/svc/x"); body != "a /svc/x 127.0.0.1" {
+		T.Fatalf("wrong prefix match: %v", body)
+	}
+	if code, _ := get("/svcadmin"); code != http.StatusNotFound {
+		T.Fatalf("prefix matched inside a segment: %v", code)
+	}
+}
+
+func TestGatewayWebSocket(T *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&wshttp.WebSocketUpgrader{}).Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(messageType, append([]byte(r.URL.Path+" "), data...))
+	}))
+	defer upstream.Close()
+
+	gateway, err := wshttp.NewGateway(&wshttp.GatewayConfig{
+		Routes: []wshttp.GatewayRoute{{
+			PathPrefix:    "/ws/",
+			RewritePrefix: "/",
+			Upstreams:     []string{upstream.URL},
+		}},
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	conn, _, err := (&wshttp.WebSocketDialer{}).Dial("ws" + strings.TrimPrefix(server.URL, "http") + "/ws/echo")
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(wshttp.TextMessage, []byte("hello")); err != nil {
+		T.Fatal(err)
+	}
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != wshttp.TextMessage || string(data) != "/echo hello" {
+		T.Fatalf("wrong echo: %v %q %v", messageType, data, err)
+	}
+}
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wl_fs "github.com/wsva/lib_go/fs"
+)
+
+const (
+	DefaultHealthCheckTimeout  = 5 * time.Second
+	DefaultHealthCheckCacheTTL = 5 * time.Second
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+var ErrHealthCheckFailed = RegisterError("HEALTH_CHECK_FAILED", http.StatusServiceUnavailable, "health check failed", ShowTypeError)
+
+/*
+HealthCheckFunc returns nil if healthy.
+it should return soon after ctx is done, but a late result is ignored anyway.
+
+ftp.FTP.Check and ssh.SSH.Check can be used directly.
+*/
+type HealthCheckFunc func(ctx context.Context) error
+
+type HealthCheck struct {
+	Name  string
+	Check HealthCheckFunc
+
+	// default DefaultHealthCheckTimeout
+	Timeout time.Duration
+
+	// results are reused within CacheTTL,
+	// default DefaultHealthCheckCacheTTL, negative to disable
+	CacheTTL time.Duration
+
+	// also checked by /livez, all checks are checked by /readyz.
+	// only checks whose failure needs a restart should be liveness checks.
+	Liveness bool
+}
+
+type HealthResult struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Cached    bool      `json:"cached"`
+}
+
+/*
+HealthRegistry runs named checks in parallel
+
+	health := NewHealthRegistry()
+	health.Register(HealthCheck{Name: "ftp", Check: f.Check})
+	health.Register(HealthCheck{Name: "disk", Check: DiskSpaceCheck("/data", 1<<30)})
+	router.GET("/livez", health.LivezHandler().ServeHTTP)
+	router.GET("/readyz", health.ReadyzHandler().ServeHTTP)
+*/
+type HealthRegistry struct {
+	mu     sync.Mutex
+	checks []*healthEntry
+	names  map[string]bool
+
+	shuttingDown atomic.Bool
+}
+
+type healthEntry struct {
+	HealthCheck
+
+	// held while checking, so concurrent requests share one run
+	mu     sync.Mutex
+	result *HealthResult
+}
+
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{names: make(map[string]bool)}
+}
+
+var DefaultHealthRegistry = NewHealthRegistry()
+
+// Register panics if name is empty or duplicated, or Check is nil
+func (h *HealthRegistry) Register(c HealthCheck) {
+	if c.Name == "" || c.Check == nil {
+		panic("health check needs Name and Check")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultHealthCheckTimeout
+	}
+	if c.CacheTTL == 0 {
+		c.CacheTTL = DefaultHealthCheckCacheTTL
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.names[c.Name] {
+		panic(fmt.Sprintf("health check already registered: %v", c.Name))
+	}
+	h.names[c.Name] = true
+	h.checks = append(h.checks, &healthEntry{HealthCheck: c})
+}
+
+func (h *HealthRegistry) RegisterFunc(name string, check HealthCheckFunc) {
+	h.Register(HealthCheck{Name: name, Check: check})
+}
+
+/*
+SetShuttingDown makes /readyz fail without running checks,
+so load balancers stop sending requests before Server.Shutdown.
+*/
+func (h *HealthRegistry) SetShuttingDown(v bool) {
+	h.shuttingDown.Store(v)
+}
+
+/*
+Run runs the checks in parallel, only liveness checks if liveness is true.
+results are in the order of registration.
+*/
+func (h *HealthRegistry) Run(ctx context.Context, liveness bool) ([]HealthResult, bool) {
+	h.mu.Lock()
+	var checks []*healthEntry
+	for _, v := range h.checks {
+		if !liveness || v.Liveness {
+			checks = append(checks, v)
+		}
+	}
+	h.mu.Unlock()
+
+	results := make([]HealthResult, len(checks))
+	var wg sync.WaitGroup
+	for i, v := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = v.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	ok := true
+	for _, v := range results {
+		if v.Status != HealthStatusOK {
+			ok = false
+		}
+	}
+	return results, ok
+}
+
+func (e *healthEntry) run(ctx context.Context) HealthResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.result != nil && e.CacheTTL > 0 && time.Since(e.result.CheckedAt) < e.CacheTTL {
+		result := *e.result
+		result.Cached = true
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := HealthResult{
+		Name:      e.Name,
+		Status:    HealthStatusOK,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = HealthStatusFail
+		result.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("timeout after %v", e.Timeout)
+		}
+	}
+	// a canceled request does not say anything about the check
+	if !errors.Is(err, context.Canceled) {
+		e.result = &result
+	}
+	return result
+}
+
+func (h *HealthRegistry) handler(liveness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !liveness && h.shuttingDown.Load() {
+			RespondError(w, ErrHealthCheckFailed.WithMessage("shutting down"))
+			return
+		}
+		results, ok := h.Run(r.Context(), liveness)
+		resp := &Response{Success: true}
+		status := http.StatusOK
+		if !ok {
+			resp, status = NewErrorResponse(ErrHealthCheckFailed)
+		}
+		resp.Data.List = results
+		resp.Data.Total = len(results)
+		if status != http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+		}
+		resp.DoResponse(w)
+	})
+}
+
+// LivezHandler serves /livez, with results of liveness checks in Data.List
+func (h *HealthRegistry) LivezHandler() http.Handler {
+	return h.handler(true)
+}
+
+// ReadyzHandler serves /readyz, with results of all checks in Data.List
+func (h *HealthRegistry) ReadyzHandler() http.Handler {
+	return h.handler(false)
+}
+
+// DiskSpaceCheck fails if the free space of the filesystem of path is less than minFree bytes
+func DiskSpaceCheck(path string, minFree uint64) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		free, err := wl_fs.DiskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%v has %v bytes free, less than %v", path, free, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestHealthRegistry(T *testing.T) {
+	health := wshttp.NewHealthRegistry()
+	var dbCalls atomic.Int32
+	health.Register(wshttp.HealthCheck{
+		Name:     "self",
+		Check:    func(ctx context.Context) error { return nil },
+		Liveness: true,
+	})
+	health.Register(wshttp.HealthCheck{
+		Name: "db",
+		Check: func(ctx context.Context) error {
+			dbCalls.Add(1)
+			return errors.New("connection refused")
+		},
+		CacheTTL: time.Minute,
+	})
+	health.Register(wshttp.HealthCheck{
+		Name: "slow",
+		Check: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+		Timeout:  50 * time.Millisecond,
+		CacheTTL: -1,
+	})
+	health.Register(wshttp.HealthCheck{Name: "disk", Check: wshttp.DiskSpaceCheck(T.TempDir(), 1)})
+
+	get := func(h http.Handler) (int, wshttp.Response, []wshttp.HealthResult) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var resp wshttp.Response
+		var body struct {
+			Data struct {
+				List []wshttp.HealthResult `json:"list"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, resp, body.Data.List
+	}
+
+	code, resp, list := get(health.LivezHandler())
+	if code != http.StatusOK || !resp.Success || len(list) != 1 || list[0].Name != "self" {
+		T.Errorf("livez: %v %+v %+v", code, resp, list)
+	}
+
+	start := time.Now()
+	code, resp, list = get(health.ReadyzHandler())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		T.Errorf("checks not run in parallel or timeout ignored: %v", elapsed)
+	}
+	if code != http.StatusServiceUnavailable || resp.Success || resp.ErrorCode != wshttp.ErrHealthCheckFailed.Code {
+		T.Errorf("readyz: %v %+v", code, resp)
+	}
+	want := map[string]string{"self": wshttp.HealthStatusOK, "db": wshttp.HealthStatusFail, "slow": wshttp.HealthStatusFail, "disk": wshttp.HealthStatusOK}
+	for _, v := range list {
+		if want[v.Name] != v.Status {
+			T.Errorf("%v: %+v", v.Name, v)
+		}
+	}
+
+	_, _, list = get(health.ReadyzHandler())
+	if dbCalls.Load() != 1 || !list[1].Cached || list[2].Cached {
+		T.Errorf("cache: calls %v, %+v", dbCalls.Load(), list)
+	}
+
+	health.SetShuttingDown(true)
+	code, resp, _ = get(health.ReadyzHandler())
+	if code != http.StatusServiceUnavailable || resp.ErrMsg != "shutting down" {
+		T.Errorf("shutting down: %v %+v", code, resp)
+	}
+}
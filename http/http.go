@@ -27,6 +27,15 @@ type HttpClient struct {
 	//used to limit the response size to read
 	LimitResponse bool //default false
 	LimitBytes    int64
+
+	//opt-in cache of GET responses, see HttpCache
+	Cache *HttpCache
+
+	//wraps the transport, like Recorder.Wrap and Replayer.Wrap in tests
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+
+	//records request count and latency, see InstrumentTransport
+	Metrics *MetricsRegistry
 }
 
 func (h *HttpClient) getHttpClient() (*http.Client, error) {
@@ -34,9 +43,18 @@ func (h *HttpClient) getHttpClient() (*http.Client, error) {
 	if timeout == 0 {
 		timeout = 10
 	}
-	tr := &http.Transport{
+	var tr http.RoundTripper = &http.Transport{
 		DisableKeepAlives: true,
 	}
+	if h.WrapTransport != nil {
+		tr = h.WrapTransport(tr)
+	}
+	if h.Cache != nil {
+		tr = h.Cache.Wrap(tr)
+	}
+	if h.Metrics != nil {
+		tr = InstrumentTransport(h.Metrics, tr)
+	}
 	return &http.Client{
 		Transport: tr,
 		Timeout:   timeout * time.Second,
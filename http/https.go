@@ -1,12 +1,14 @@
 package http
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -58,6 +60,24 @@ func (s *HttpsServer) ListenAndServe(handler http.Handler) error {
 	return server.ListenAndServeTLS(s.ServerCrtFile, s.ServerKeyFile)
 }
 
+/*
+ListenAndServeContext is like ListenAndServe, but shuts down gracefully
+when ctx is done, see Server
+*/
+func (s *HttpsServer) ListenAndServeContext(ctx context.Context, handler http.Handler) error {
+	port, err := strconv.Atoi(s.Port)
+	if err != nil {
+		return err
+	}
+	server := &Server{
+		ListenList:    []ListenInfo{{Enable: true, Port: port, Protocol: "https"}},
+		ServerCrtFile: s.ServerCrtFile,
+		ServerKeyFile: s.ServerKeyFile,
+		CACrtFile:     s.CACrtFile,
+	}
+	return server.Serve(ctx, handler)
+}
+
 type HttpsClient struct {
 	ServerAddress string
 
@@ -84,6 +104,15 @@ type HttpsClient struct {
 	//used to limit the response size to read
 	LimitResponse bool //default false
 	LimitBytes    int64
+
+	//opt-in cache of GET responses, see HttpCache
+	Cache *HttpCache
+
+	//wraps the transport, like Recorder.Wrap and Replayer.Wrap in tests
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+
+	//records request count and latency, see InstrumentTransport
+	Metrics *MetricsRegistry
 }
 
 func (h *HttpsClient) getCACrtPool() (*x509.CertPool, error) {
@@ -110,41 +139,53 @@ func (h *HttpsClient) getClientCert() (*tls.Certificate, error) {
 	return &clientCert, err
 }
 
-func (h *HttpsClient) getHttpClient(skipVerify bool) (*http.Client, error) {
+/*
+TLSConfig returns the tls settings of h: CA file, mutual TLS, or skipVerify,
+it is also used by WebSocketDialer
+*/
+func (h *HttpsClient) TLSConfig(skipVerify bool) (*tls.Config, error) {
 	caPool, err := h.getCACrtPool()
 	if err != nil && !skipVerify {
 		return nil, err
 	}
 
-	var tr *http.Transport
 	if h.MutualTLS {
 		clientCert, err := h.getClientCert()
 		if err != nil {
 			return nil, err
 		}
-		tr = &http.Transport{
-			DisableKeepAlives: true,
-			TLSClientConfig: &tls.Config{
-				RootCAs:      caPool,
-				Certificates: []tls.Certificate{*clientCert},
-			},
-		}
-	} else {
-		if skipVerify {
-			tr = &http.Transport{
-				DisableKeepAlives: true,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			}
-		} else {
-			tr = &http.Transport{
-				DisableKeepAlives: true,
-				TLSClientConfig: &tls.Config{
-					RootCAs: caPool,
-				},
-			}
-		}
+		return &tls.Config{
+			RootCAs:      caPool,
+			Certificates: []tls.Certificate{*clientCert},
+		}, nil
+	}
+	if skipVerify {
+		return &tls.Config{
+			InsecureSkipVerify: true,
+		}, nil
+	}
+	return &tls.Config{
+		RootCAs: caPool,
+	}, nil
+}
+
+func (h *HttpsClient) getHttpClient(skipVerify bool) (*http.Client, error) {
+	tlsConfig, err := h.TLSConfig(skipVerify)
+	if err != nil {
+		return nil, err
+	}
+	var tr http.RoundTripper = &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   tlsConfig,
+	}
+	if h.WrapTransport != nil {
+		tr = h.WrapTransport(tr)
+	}
+	if h.Cache != nil {
+		tr = h.Cache.Wrap(tr)
+	}
+	if h.Metrics != nil {
+		tr = InstrumentTransport(h.Metrics, tr)
 	}
 
 	timeout := h.Timeout
@@ -0,0 +1,376 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets in seconds, same as Prometheus
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var regexpMetricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+/*
+MetricsRegistry holds counters, gauges and histograms,
+and exports them in Prometheus text format.
+
+	registry := NewMetricsRegistry()
+	jobs := registry.NewCounter("jobs_total", "Jobs processed.", "result")
+	jobs.Inc("ok")
+	router.Use(Metrics(registry))
+	router.GET("/metrics", registry.Handler().ServeHTTP)
+
+registering the same name again returns the existing metric if type and
+labels are the same, and panics otherwise.
+*/
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics []*metricVec
+	names   map[string]*metricVec
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{names: make(map[string]*metricVec)}
+}
+
+var DefaultMetricsRegistry = NewMetricsRegistry()
+
+const (
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+)
+
+type metricVec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// histogram only, not cumulative
+	counts []uint64
+	count  uint64
+}
+
+func (r *MetricsRegistry) register(name, help, typ string, buckets []float64, labelNames []string) *metricVec {
+	if !regexpMetricName.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name: %v", name))
+	}
+	for _, v := range labelNames {
+		if !regexpMetricName.MatchString(v) || strings.Contains(v, ":") || v == "le" {
+			panic(fmt.Sprintf("invalid label name of %v: %v", name, v))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.names[name]; ok {
+		if m.typ != typ || strings.Join(m.labelNames, ",") != strings.Join(labelNames, ",") {
+			panic(fmt.Sprintf("metric %v already registered as %v%v", name, m.typ, m.labelNames))
+		}
+		return m
+	}
+	m := &metricVec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries),
+	}
+	r.metrics = append(r.metrics, m)
+	r.names[name] = m
+	return m
+}
+
+// with must be called with m.mu locked
+func (m *metricVec) with(labelValues []string) *metricSeries {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %v expects %v label values, got %v",
+			m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if m.typ == metricTypeHistogram {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *metricVec) add(v float64, labelValues []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.with(labelValues).value += v
+}
+
+// Counter only goes up
+type Counter struct {
+	vec *metricVec
+}
+
+func (r *MetricsRegistry) NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{vec: r.register(name, help, metricTypeCounter, nil, labelNames)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.vec.add(1, labelValues)
+}
+
+// Add panics if v is negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %v cannot decrease", c.vec.name))
+	}
+	c.vec.add(v, labelValues)
+}
+
+// Gauge can go up and down
+type Gauge struct {
+	vec *metricVec
+}
+
+func (r *MetricsRegistry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{vec: r.register(name, help, metricTypeGauge, nil, labelNames)}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.mu.Lock()
+	defer g.vec.mu.Unlock()
+	g.vec.with(labelValues).value = v
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.vec.add(v, labelValues)
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.vec.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.vec.add(-1, labelValues)
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	vec *metricVec
+}
+
+// NewHistogram uses DefaultBuckets if buckets is empty
+func (r *MetricsRegistry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	if math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+	return &Histogram{vec: r.register(name, help, metricTypeHistogram, buckets, labelNames)}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.vec.mu.Lock()
+	defer h.vec.mu.Unlock()
+	s := h.vec.with(labelValues)
+	// the +Inf bucket is count
+	if i := sort.SearchFloat64s(h.vec.buckets, v); i < len(h.vec.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += v
+}
+
+// ObserveDuration observes the seconds since start
+func (h *Histogram) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// WriteTo writes all metrics in Prometheus text format
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]*metricVec(nil), r.metrics...)
+	r.mu.Unlock()
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// Handler serves the metrics for scraping
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+func (m *metricVec) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.series) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "# HELP %v %v\n", m.name, escapeMetricHelp(m.help))
+	fmt.Fprintf(buf, "# TYPE %v %v\n", m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.typ != metricTypeHistogram {
+			fmt.Fprintf(buf, "%v%v %v\n", m.name, m.labels(s, ""), formatMetricValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, v := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(buf, "%v_bucket%v %v\n", m.name, m.labels(s, formatMetricValue(v)), cumulative)
+		}
+		fmt.Fprintf(buf, "%v_bucket%v %v\n", m.name, m.labels(s, "+Inf"), s.count)
+		fmt.Fprintf(buf, "%v_sum%v %v\n", m.name, m.labels(s, ""), formatMetricValue(s.value))
+		fmt.Fprintf(buf, "%v_count%v %v\n", m.name, m.labels(s, ""), s.count)
+	}
+}
+
+// labels returns {a="x",b="y"}, with le if not empty
+func (m *metricVec) labels(s *metricSeries, le string) string {
+	var list []string
+	for i, v := range m.labelNames {
+		list = append(list, v+`="`+escapeLabelValue(s.labelValues[i])+`"`)
+	}
+	if le != "" {
+		list = append(list, `le="`+le+`"`)
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(list, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	metricHelpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	metricLabelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeMetricHelp(s string) string {
+	return metricHelpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return metricLabelReplacer.Replace(s)
+}
+
+// metricMethod keeps the method label bounded
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+/*
+Metrics records for each request:
+
+	http_requests_total{method,route,status}
+	http_request_duration_seconds{method,route}
+	http_requests_in_flight
+
+route is the pattern matched by Router, like /users/:id,
+or "unmatched" if no route is matched or Router is not used,
+so raw paths never become labels.
+*/
+func Metrics(registry *MetricsRegistry) Middleware {
+	requests := registry.NewCounter("http_requests_total",
+		"Total number of HTTP requests.", "method", "route", "status")
+	duration := registry.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency in seconds.", nil, "method", "route")
+	inFlight := registry.NewGauge("http_requests_in_flight",
+		"Number of HTTP requests being served.")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+			route := new(string)
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), contextKeyRoute, route)))
+			if *route == "" {
+				*route = "unmatched"
+			}
+			method := metricMethod(r.Method)
+			requests.Inc(method, *route, strconv.Itoa(sw.Status()))
+			duration.ObserveDuration(start, method, *route)
+		})
+	}
+}
+
+/*
+InstrumentTransport records for each client request:
+
+	http_client_requests_total{method,host,status}
+	http_client_request_duration_seconds{method,host}
+
+status is "error" if no response is received.
+it is used by HttpClient and HttpsClient if Metrics is set.
+*/
+func InstrumentTransport(registry *MetricsRegistry, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	requests := registry.NewCounter("http_client_requests_total",
+		"Total number of HTTP client requests.", "method", "host", "status")
+	duration := registry.NewHistogram("http_client_request_duration_seconds",
+		"HTTP client request latency in seconds.", nil, "method", "host")
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := base.RoundTrip(req)
+		method := metricMethod(req.Method)
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(resp.StatusCode)
+		}
+		requests.Inc(method, req.URL.Host, status)
+		duration.ObserveDuration(start, method, req.URL.Host)
+		return resp, err
+	})
+}
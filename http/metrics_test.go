@@ -0,0 +1,101 @@
+package http_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func scrape(T *testing.T, registry *wshttp.MetricsRegistry) string {
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		T.Errorf("Content-Type: %v", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsRegistry(T *testing.T) {
+	registry := wshttp.NewMetricsRegistry()
+	counter := registry.NewCounter("jobs_total", "Jobs processed.", "result")
+	counter.Inc("ok")
+	counter.Add(2, "ok")
+	counter.Inc(`say "hi"`)
+	if registry.NewCounter("jobs_total", "Jobs processed.", "result") == nil {
+		T.Error("expected existing counter")
+	}
+	gauge := registry.NewGauge("queue_size", "Queue size.")
+	gauge.Set(5)
+	gauge.Dec()
+	histogram := registry.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	body := scrape(T, registry)
+	for _, want := range []string{
+		"# HELP jobs_total Jobs processed.\n# TYPE jobs_total counter\n",
+		`jobs_total{result="ok"} 3`,
+		`jobs_total{result="say \"hi\""} 1`,
+		"# TYPE queue_size gauge\nqueue_size 4\n",
+		`latency_seconds_bucket{le="0.1"} 1`,
+		`latency_seconds_bucket{le="1"} 2`,
+		`latency_seconds_bucket{le="+Inf"} 3`,
+		"latency_seconds_sum 5.55\n",
+		"latency_seconds_count 3\n",
+	} {
+		if !strings.Contains(body, want) {
+			T.Errorf("missing %q in:\n%v", want, body)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				T.Error("expected panic on conflicting registration")
+			}
+		}()
+		registry.NewGauge("jobs_total", "")
+	}()
+}
+
+func TestMetricsMiddleware(T *testing.T) {
+	registry := wshttp.NewMetricsRegistry()
+	router := wshttp.NewRouter()
+	router.Use(wshttp.Metrics(registry))
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, wshttp.PathParam(r, "id"))
+	})
+	router.GET("/metrics", registry.Handler().ServeHTTP)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := wshttp.HttpClient{Method: http.MethodGet, Metrics: registry}
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		client.Address = server.URL + path
+		client.DoRequest()
+	}
+	client.Address = server.URL + "/metrics"
+	resp, err := client.DoRequest()
+	if err != nil {
+		T.Fatal(err)
+	}
+	body := string(resp)
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`,
+		`http_requests_in_flight 1`,
+		`http_client_requests_total{method="GET",host="` + host + `",status="200"} 2`,
+		`http_client_requests_total{method="GET",host="` + host + `",status="404"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			T.Errorf("missing %q in:\n%v", want, body)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/wsva/lib_go/logger"
+	wsnet "github.com/wsva/lib_go/net"
+	"github.com/wsva/lib_go/uuid"
+)
+
+// Middleware wraps a http.Handler with extra behavior
+type Middleware func(http.Handler) http.Handler
+
+/*
+HandlerFuncWithNext is the negroni style middleware,
+like CheckClientCertExist and CheckClientCertIP
+*/
+type HandlerFuncWithNext func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
+
+// Wrap converts a HandlerFuncWithNext to a Middleware
+func Wrap(f HandlerFuncWithNext) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f(w, r, next.ServeHTTP)
+		})
+	}
+}
+
+// Unwrap converts a Middleware to a HandlerFuncWithNext
+func Unwrap(m Middleware) HandlerFuncWithNext {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		m(next).ServeHTTP(w, r)
+	}
+}
+
+/*
+Chain is a list of middlewares, the first one is the outermost
+
+	handler := NewChain(Recover(l), RequestID(), Wrap(CheckClientCertExist)).Then(mux)
+*/
+type Chain []Middleware
+
+func NewChain(middlewares ...Middleware) Chain {
+	return append(Chain(nil), middlewares...)
+}
+
+// Append returns a new Chain, c is not modified
+func (c Chain) Append(middlewares ...Middleware) Chain {
+	result := make(Chain, 0, len(c)+len(middlewares))
+	result = append(result, c...)
+	return append(result, middlewares...)
+}
+
+func (c Chain) Then(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+func (c Chain) ThenFunc(f http.HandlerFunc) http.Handler {
+	return c.Then(f)
+}
+
+/*
+Recover catches panics in next handlers, logs the stack,
+and responds ErrInternal through RespondError
+*/
+func Recover(l logger.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				if l != nil {
+					l.Error("panic: %v %v: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+				}
+				RespondError(w, ErrInternal)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const HeaderRequestID = "X-Request-Id"
+
+type contextKey int
+
+const (
+	contextKeyRequestID contextKey = iota
+	contextKeyCertIdentity
+	contextKeyPathParams
+	contextKeyRoute
+	contextKeySession
+)
+
+var hostname, _ = os.Hostname()
+
+/*
+RequestID reuses the X-Request-Id of the request, or generates a new one.
+The id is set in the response header, and is picked by Response.DoResponse
+to populate TraceId and Host.
+*/
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(HeaderRequestID)
+			if id == "" || len(id) > 128 {
+				id = uuid.New()
+			}
+			w.Header().Set(HeaderRequestID, id)
+			ctx := context.WithValue(r.Context(), contextKeyRequestID, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetRequestID returns the id set by RequestID, or empty
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(contextKeyRequestID).(string)
+	return id
+}
+
+/*
+AccessLog logs one line for every request:
+
+	ip method uri proto status bytes duration
+
+nil logs to stdout by logger.NewLogger.
+*/
+func AccessLog(l logger.Logger) Middleware {
+	if l == nil {
+		l = logger.NewLogger("access", logger.LogLevelInfo)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			l.Info("%v %v %v %v %v %v %v",
+				wsnet.GetIPFromRequest(r),
+				r.Method,
+				r.RequestURI,
+				r.Proto,
+				sw.Status(),
+				sw.size,
+				time.Since(start))
+		})
+	}
+}
+
+// statusWriter records the status code and the size of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+
+	// called once before the header is written, headers can still be set
+	beforeHeader func()
+	// set by beforeHeader after responding instead of the handler,
+	// the header and body of the handler are dropped
+	discard bool
+}
+
+var errResponseDiscarded = errors.New("response discarded")
+
+func (w *statusWriter) callBeforeHeader() {
+	if w.beforeHeader != nil {
+		f := w.beforeHeader
+		w.beforeHeader = nil
+		f()
+	}
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.callBeforeHeader()
+	}
+	if w.discard {
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.callBeforeHeader()
+	}
+	if w.discard {
+		return 0, errResponseDiscarded
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Flush() {
+	w.callBeforeHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+// Unwrap is used by http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
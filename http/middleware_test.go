@@ -0,0 +1,133 @@
+package http_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestChain(T *testing.T) {
+	var order []string
+	mark := func(name string) wshttp.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	negroni := func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		order = append(order, "negroni")
+		next(w, r)
+	}
+	handler := wshttp.NewChain(mark("a"), wshttp.Wrap(negroni)).
+		Append(mark("b")).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+	handler = wshttp.NewChain(wshttp.Recover(nil), wshttp.RequestID()).Then(handler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(order) != 3 || order[0] != "a" || order[1] != "negroni" || order[2] != "b" {
+		T.Fatalf("wrong order: %v", order)
+	}
+	if w.Code != http.StatusInternalServerError {
+		T.Fatalf("wrong status: %v", w.Code)
+	}
+	var resp wshttp.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		T.Fatal(err)
+	}
+	if resp.Success || resp.TraceId == "" || resp.TraceId != w.Header().Get(wshttp.HeaderRequestID) {
+		T.Fatalf("wrong response: %+v", resp)
+	}
+}
+
+func TestGzipMiddleware(T *testing.T) {
+	handler := wshttp.Gzip()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wshttp.RespondSuccess(w)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		T.Fatal("response not compressed")
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		T.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if string(body) != `{"success":true,"data":{}}` {
+		T.Fatalf("wrong body: %s", body)
+	}
+
+	for accept, compressed := range map[string]bool{
+		"gzip;q=0":            false,
+		"gzip; q=0.0, br":     false,
+		"*;q=0.5":             true,
+		"gzip;q=0, *":         false,
+		"deflate, GZIP;q=0.8": true,
+		"identity":            false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if (w.Header().Get("Content-Encoding") == "gzip") != compressed {
+			T.Errorf("%q: Content-Encoding %q", accept, w.Header().Get("Content-Encoding"))
+		}
+	}
+}
+
+func TestAccessLogNil(T *testing.T) {
+	handler := wshttp.AccessLog(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wshttp.RespondSuccess(w)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		T.Fatalf("wrong status: %v", w.Code)
+	}
+}
+
+func TestCORS(T *testing.T) {
+	preflight := func(c *wshttp.CORSConfig, origin string) http.Header {
+		handler := wshttp.CORS(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest(http.MethodOptions, "/", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header()
+	}
+
+	if h := preflight(nil, "https://a.example.com"); h.Get("Access-Control-Allow-Origin") != "https://a.example.com" ||
+		h.Get("Access-Control-Allow-Credentials") != "" {
+		T.Errorf("wildcard: %v", h)
+	}
+
+	c := wshttp.DefaultCORSConfig()
+	c.AllowCredentials = true
+	if h := preflight(c, "https://evil.example.com"); h.Get("Access-Control-Allow-Origin") != "" ||
+		h.Get("Access-Control-Allow-Credentials") != "" {
+		T.Errorf("wildcard with credentials: %v", h)
+	}
+	c.AllowOrigins = append(c.AllowOrigins, "https://a.example.com")
+	if h := preflight(c, "https://a.example.com"); h.Get("Access-Control-Allow-Origin") != "https://a.example.com" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" {
+		T.Errorf("listed with credentials: %v", h)
+	}
+	if h := preflight(c, "https://evil.example.com"); h.Get("Access-Control-Allow-Origin") != "" {
+		T.Errorf("not listed with credentials: %v", h)
+	}
+}
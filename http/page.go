@@ -0,0 +1,333 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 1000
+)
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+/*
+PageQuery is the query of Ant Design Pro ProTable:
+
+	?current=2&pageSize=20&sorter={"name":"ascend"}&filter={"status":["a","b"]}
+*/
+type PageQuery struct {
+	// starts from 1
+	Current  int
+	PageSize int
+
+	Sorter []SortField
+	Filter map[string][]string
+}
+
+/*
+ParsePageQuery parses current, pageSize, sorter and filter.
+pageSize defaults to defaultPageSize, and is limited to maxPageSize.
+*/
+func ParsePageQuery(r *http.Request, defaultPageSize, maxPageSize int) (*PageQuery, error) {
+	if defaultPageSize <= 0 {
+		defaultPageSize = DefaultPageSize
+	}
+	if maxPageSize <= 0 {
+		maxPageSize = MaxPageSize
+	}
+	current, err := QueryInt(r, "current", 1)
+	if err != nil {
+		return nil, err
+	}
+	pageSize, err := QueryInt(r, "pageSize", defaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if current < 1 {
+		current = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	q := &PageQuery{
+		Current:  current,
+		PageSize: pageSize,
+		Filter:   make(map[string][]string),
+	}
+
+	if sorter := QueryString(r, "sorter", ""); sorter != "" {
+		var m map[string]string
+		if err := json.Unmarshal([]byte(sorter), &m); err != nil {
+			return nil, ErrBadRequest.WithMessage("invalid sorter: %v", sorter)
+		}
+		for k, v := range m {
+			switch v {
+			case "ascend", "asc":
+				q.Sorter = append(q.Sorter, SortField{Field: k})
+			case "descend", "desc":
+				q.Sorter = append(q.Sorter, SortField{Field: k, Desc: true})
+			default:
+				return nil, ErrBadRequest.WithMessage("invalid sort order of %v: %v", k, v)
+			}
+		}
+		// json object has no order
+		sort.Slice(q.Sorter, func(i, j int) bool {
+			return q.Sorter[i].Field < q.Sorter[j].Field
+		})
+	}
+
+	if filter := QueryString(r, "filter", ""); filter != "" {
+		var m map[string][]string
+		if err := json.Unmarshal([]byte(filter), &m); err != nil {
+			return nil, ErrBadRequest.WithMessage("invalid filter: %v", filter)
+		}
+		for k, v := range m {
+			if len(v) > 0 {
+				q.Filter[k] = v
+			}
+		}
+	}
+	return q, nil
+}
+
+// Offset is math.MaxInt if it overflows
+func (q *PageQuery) Offset() int {
+	if q.Current < 1 || q.PageSize < 1 {
+		return 0
+	}
+	if q.Current-1 > math.MaxInt/q.PageSize {
+		return math.MaxInt
+	}
+	return (q.Current - 1) * q.PageSize
+}
+
+/*
+Paginator sorts, filters and slices in-memory lists.
+
+Compare and Match are keyed by field name, unknown fields in
+PageQuery are ignored.
+*/
+type Paginator[T any] struct {
+	// returns negative if a < b, 0 if equal, positive if a > b
+	Compare map[string]func(a, b T) int
+
+	// returns true if item matches any of values
+	Match map[string]func(item T, values []string) bool
+}
+
+// Page returns a successful Response with one page of list
+func (p *Paginator[T]) Page(list []T, q *PageQuery) *Response {
+	result := make([]T, 0, len(list))
+	for _, v := range list {
+		if p.match(v, q.Filter) {
+			result = append(result, v)
+		}
+	}
+	if len(q.Sorter) > 0 && len(p.Compare) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			for _, s := range q.Sorter {
+				compare, ok := p.Compare[s.Field]
+				if !ok {
+					continue
+				}
+				c := compare(result[i], result[j])
+				if c == 0 {
+					continue
+				}
+				if s.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	return pageResponse(result, q)
+}
+
+func (p *Paginator[T]) match(item T, filter map[string][]string) bool {
+	for k, v := range filter {
+		match, ok := p.Match[k]
+		if ok && !match(item, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Paginate slices list without sorting and filtering
+func Paginate[T any](list []T, q *PageQuery) *Response {
+	return pageResponse(list, q)
+}
+
+func pageResponse[T any](list []T, q *PageQuery) *Response {
+	start := q.Offset()
+	if start > len(list) {
+		start = len(list)
+	}
+	end := len(list)
+	if q.PageSize >= 0 && q.PageSize < end-start {
+		end = start + q.PageSize
+	}
+	return &Response{
+		Success: true,
+		Data: ResponseData{
+			List:     list[start:end],
+			Current:  q.Current,
+			PageSize: q.PageSize,
+			Total:    len(list),
+		},
+	}
+}
+
+// PageFetcher returns the Response bytes of one page
+type PageFetcher func(current, pageSize int) ([]byte, error)
+
+/*
+HttpPageFetcher requests the Address of client with current and pageSize
+added to the query, client is copied for every page
+*/
+func HttpPageFetcher(client *HttpClient) PageFetcher {
+	return func(current, pageSize int) ([]byte, error) {
+		u, err := url.Parse(client.Address)
+		if err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		query.Set("current", strconv.Itoa(current))
+		query.Set("pageSize", strconv.Itoa(pageSize))
+		u.RawQuery = query.Encode()
+		c := *client
+		c.Address = u.String()
+		return c.DoRequest()
+	}
+}
+
+/*
+PageIterator walks all pages of a remote paginated endpoint.
+it stops at total if the server reports it, otherwise at a short page,
+pageSize clamped by the server is followed.
+
+	it := NewPageIterator[User](100, HttpPageFetcher(client))
+	for it.Next() {
+		for _, v := range it.Page() {
+		}
+	}
+	if err := it.Err(); err != nil {
+	}
+*/
+type PageIterator[T any] struct {
+	fetch    PageFetcher
+	pageSize int
+	current  int
+	page     []T
+	total    int
+	seen     int
+	done     bool
+	err      error
+}
+
+func NewPageIterator[T any](pageSize int, fetch PageFetcher) *PageIterator[T] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &PageIterator[T]{
+		fetch:    fetch,
+		pageSize: pageSize,
+	}
+}
+
+type typedResponse[T any] struct {
+	Success bool `json:"success"`
+	Data    struct {
+		List     []T `json:"list"`
+		Current  int `json:"current"`
+		PageSize int `json:"pageSize"`
+		Total    int `json:"total"`
+	} `json:"data"`
+	ErrorCode string `json:"errorCode"`
+	ErrMsg    string `json:"errMsg"`
+}
+
+// Next fetches the next page, returns false when done or on error
+func (it *PageIterator[T]) Next() bool {
+	if it.done {
+		return false
+	}
+	it.current++
+	respBytes, err := it.fetch(it.current, it.pageSize)
+	if err != nil {
+		return it.fail(err)
+	}
+	var resp typedResponse[T]
+	err = json.Unmarshal(respBytes, &resp)
+	if err != nil {
+		return it.fail(err)
+	}
+	if !resp.Success {
+		if resp.ErrMsg == "" {
+			resp.ErrMsg = "request failed"
+		}
+		return it.fail(errors.New(strings.TrimSpace(resp.ErrorCode + " " + resp.ErrMsg)))
+	}
+	it.page = resp.Data.List
+	it.total = resp.Data.Total
+	it.seen += len(it.page)
+	if resp.Data.PageSize > 0 {
+		it.pageSize = resp.Data.PageSize
+	}
+	if len(it.page) == 0 {
+		it.done = true
+		return false
+	}
+	// this page is still returned
+	if it.total > 0 {
+		it.done = it.seen >= it.total
+	} else {
+		it.done = len(it.page) < it.pageSize
+	}
+	return true
+}
+
+func (it *PageIterator[T]) fail(err error) bool {
+	it.err = err
+	it.page = nil
+	it.done = true
+	return false
+}
+
+func (it *PageIterator[T]) Page() []T {
+	return it.page
+}
+
+// Total is reported by the last page
+func (it *PageIterator[T]) Total() int {
+	return it.total
+}
+
+func (it *PageIterator[T]) Err() error {
+	return it.err
+}
+
+// All fetches all pages
+func (it *PageIterator[T]) All() ([]T, error) {
+	var result []T
+	for it.Next() {
+		result = append(result, it.Page()...)
+	}
+	return result, it.Err()
+}
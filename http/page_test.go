@@ -0,0 +1,103 @@
+package http_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+type pageUser struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func TestPaginator(T *testing.T) {
+	var list []pageUser
+	for _, v := range []string{"e", "d", "c", "b", "a"} {
+		status := "on"
+		if v == "c" {
+			status = "off"
+		}
+		list = append(list, pageUser{Name: v, Status: status})
+	}
+	p := &wshttp.Paginator[pageUser]{
+		Compare: map[string]func(a, b pageUser) int{
+			"name": func(a, b pageUser) int { return strings.Compare(a.Name, b.Name) },
+		},
+		Match: map[string]func(item pageUser, values []string) bool{
+			"status": func(item pageUser, values []string) bool { return item.Status == values[0] },
+		},
+	}
+
+	query := url.Values{}
+	query.Set("current", "2")
+	query.Set("pageSize", "2")
+	query.Set("sorter", `{"name":"ascend"}`)
+	query.Set("filter", `{"status":["on"]}`)
+	q, err := wshttp.ParsePageQuery(httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil), 0, 0)
+	if err != nil {
+		T.Fatal(err)
+	}
+	resp := p.Page(list, q)
+	page := resp.Data.List.([]pageUser)
+	if resp.Data.Total != 4 || len(page) != 2 || page[0].Name != "d" || page[1].Name != "e" {
+		T.Fatalf("wrong page: %+v", resp.Data)
+	}
+
+	// walk all pages through the iterator
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, _ := wshttp.ParsePageQuery(r, 0, 0)
+		wshttp.Paginate(list, q).DoResponse(w)
+	}))
+	defer server.Close()
+	it := wshttp.NewPageIterator[pageUser](2, wshttp.HttpPageFetcher(&wshttp.HttpClient{
+		Address: server.URL,
+		Method:  http.MethodGet,
+	}))
+	all, err := it.All()
+	if err != nil {
+		T.Fatal(err)
+	}
+	var names bytes.Buffer
+	for _, v := range all {
+		names.WriteString(v.Name)
+	}
+	if names.String() != "edcba" {
+		T.Fatalf("wrong list: %v", names.String())
+	}
+
+	// the server clamps pageSize
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, _ := wshttp.ParsePageQuery(r, 0, 2)
+		wshttp.Paginate(list, q).DoResponse(w)
+	}))
+	defer server.Close()
+	it = wshttp.NewPageIterator[pageUser](3, wshttp.HttpPageFetcher(&wshttp.HttpClient{
+		Address: server.URL,
+		Method:  http.MethodGet,
+	}))
+	all, err = it.All()
+	if err != nil || len(all) != len(list) {
+		T.Fatalf("clamped pageSize: %v, %v", len(all), err)
+	}
+}
+
+func TestPaginateOverflow(T *testing.T) {
+	list := []int{1, 2, 3}
+	for _, current := range []string{"9223372036854775807", "4611686018427387905", "3"} {
+		r := httptest.NewRequest(http.MethodGet, "/?pageSize=2&current="+current, nil)
+		q, err := wshttp.ParsePageQuery(r, 0, 0)
+		if err != nil {
+			T.Fatal(err)
+		}
+		resp := wshttp.Paginate(list, q)
+		if page := resp.Data.List.([]int); len(page) != 0 || resp.Data.Total != 3 {
+			T.Errorf("current %v: %+v", current, resp.Data)
+		}
+	}
+}
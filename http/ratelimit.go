@@ -0,0 +1,335 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	wsnet "github.com/wsva/lib_go/net"
+)
+
+// RateLimiter decides if a request of key is allowed now
+type RateLimiter interface {
+	// Allow returns false and the time to wait, if the request is denied
+	Allow(key string) (bool, time.Duration)
+}
+
+// KeyFunc returns the key to limit by, empty key is not limited
+type KeyFunc func(r *http.Request) string
+
+func KeyByIP(r *http.Request) string {
+	ip := wsnet.GetIPFromRequest(r)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// KeyByCertCommonName uses the CN of client certificate, for mutual https
+func KeyByCertCommonName(r *http.Request) string {
+	return GetClientCertCommonName(r)
+}
+
+/*
+KeyByUsername uses Request.Username in the body.
+At most limit bytes of body are read, and the whole body is still there for next handlers.
+*/
+func KeyByUsername(limit int64) KeyFunc {
+	return func(r *http.Request) string {
+		if r.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, limit))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil {
+			return ""
+		}
+		var req Request
+		json.Unmarshal(body, &req)
+		return req.Username
+	}
+}
+
+/*
+rateStore keeps one state per key in memory.
+keys idle for longer than ttl are evicted, and at most maxKeys are kept.
+*/
+type rateStore[T any] struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	maxKeys   int
+	entries   map[string]*rateEntry[T]
+	lastSweep time.Time
+}
+
+type rateEntry[T any] struct {
+	state    T
+	lastSeen time.Time
+}
+
+func newRateStore[T any](ttl time.Duration, maxKeys int) *rateStore[T] {
+	return &rateStore[T]{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		entries: make(map[string]*rateEntry[T]),
+	}
+}
+
+// do calls f with the state of key, holding the lock
+func (s *rateStore[T]) do(key string, now time.Time, f func(state *T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > s.ttl {
+		s.sweep(now)
+	}
+	e, ok := s.entries[key]
+	if !ok {
+		if s.maxKeys > 0 && len(s.entries) >= s.maxKeys {
+			s.sweep(now)
+			if len(s.entries) >= s.maxKeys {
+				s.evictOldest()
+			}
+		}
+		e = &rateEntry[T]{}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+	f(&e.state)
+}
+
+func (s *rateStore[T]) sweep(now time.Time) {
+	for k, v := range s.entries {
+		if now.Sub(v.lastSeen) > s.ttl {
+			delete(s.entries, k)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *rateStore[T]) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for k, v := range s.entries {
+		if oldestKey == "" || v.lastSeen.Before(oldest) {
+			oldestKey = k
+			oldest = v.lastSeen
+		}
+	}
+	delete(s.entries, oldestKey)
+}
+
+func (s *rateStore[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+const DefaultRateLimitMaxKeys = 100000
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+/*
+TokenBucket allows Burst requests at once, refilled at Rate per second
+*/
+type TokenBucket struct {
+	Rate  float64
+	Burst int
+
+	store *rateStore[tokenBucket]
+	now   func() time.Time
+}
+
+// NewTokenBucket panics if rate or burst <= 0, maxKeys <= 0 means DefaultRateLimitMaxKeys
+func NewTokenBucket(rate float64, burst int, maxKeys int) *TokenBucket {
+	if rate <= 0 || burst <= 0 {
+		panic(fmt.Sprintf("invalid token bucket: rate %v, burst %v", rate, burst))
+	}
+	if maxKeys <= 0 {
+		maxKeys = DefaultRateLimitMaxKeys
+	}
+	// a bucket idle for this long is full again, so it can be evicted
+	ttl := time.Duration(float64(burst)/rate*float64(time.Second)) + time.Minute
+	return &TokenBucket{
+		Rate:  rate,
+		Burst: burst,
+		store: newRateStore[tokenBucket](ttl, maxKeys),
+		now:   time.Now,
+	}
+}
+
+func (t *TokenBucket) Allow(key string) (bool, time.Duration) {
+	now := t.now()
+	allowed := false
+	var wait time.Duration
+	t.store.do(key, now, func(b *tokenBucket) {
+		if b.last.IsZero() {
+			b.tokens = float64(t.Burst)
+		} else {
+			b.tokens = math.Min(float64(t.Burst),
+				b.tokens+now.Sub(b.last).Seconds()*t.Rate)
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			allowed = true
+			return
+		}
+		wait = time.Duration((1 - b.tokens) / t.Rate * float64(time.Second))
+	})
+	return allowed, wait
+}
+
+/*
+SlidingWindow allows Limit requests in any Window.
+
+the count of the previous fixed window is weighted by its overlap
+with the sliding window, which needs only two counters per key
+*/
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+
+	store *rateStore[slidingWindow]
+	now   func() time.Time
+}
+
+type slidingWindow struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// NewSlidingWindow, maxKeys <= 0 means DefaultRateLimitMaxKeys
+func NewSlidingWindow(limit int, window time.Duration, maxKeys int) *SlidingWindow {
+	if maxKeys <= 0 {
+		maxKeys = DefaultRateLimitMaxKeys
+	}
+	return &SlidingWindow{
+		Limit:  limit,
+		Window: window,
+		store:  newRateStore[slidingWindow](2*window, maxKeys),
+		now:    time.Now,
+	}
+}
+
+func (s *SlidingWindow) Allow(key string) (bool, time.Duration) {
+	now := s.now()
+	allowed := false
+	var wait time.Duration
+	s.store.do(key, now, func(w *slidingWindow) {
+		start := now.Truncate(s.Window)
+		switch {
+		case w.start.Equal(start):
+		case w.start.Add(s.Window).Equal(start):
+			w.previous, w.current = w.current, 0
+			w.start = start
+		default:
+			w.previous, w.current = 0, 0
+			w.start = start
+		}
+		elapsed := now.Sub(start)
+		weight := 1 - float64(elapsed)/float64(s.Window)
+		count := float64(w.previous)*weight + float64(w.current)
+		if count+1 <= float64(s.Limit) {
+			w.current++
+			allowed = true
+			return
+		}
+		if w.previous == 0 || float64(w.current)+1 > float64(s.Limit) {
+			wait = s.Window - elapsed
+			return
+		}
+		// wait until the weight of previous window is small enough
+		need := 1 - (float64(s.Limit)-float64(w.current)-1)/float64(w.previous)
+		wait = time.Duration(need*float64(s.Window)) - elapsed
+		if wait < 0 {
+			wait = 0
+		}
+	})
+	return allowed, wait
+}
+
+/*
+RateLimit limits requests by key, denied requests get 429 with Retry-After
+*/
+func RateLimit(limiter RateLimiter, keyFunc KeyFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !checkRateLimit(w, r, limiter, keyFunc) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func checkRateLimit(w http.ResponseWriter, r *http.Request,
+	limiter RateLimiter, keyFunc KeyFunc) bool {
+	key := keyFunc(r)
+	if key == "" {
+		return true
+	}
+	allowed, wait := limiter.Allow(key)
+	if allowed {
+		return true
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	RespondError(w, ErrTooManyRequests.WithMessage(
+		"too many requests, retry after %v seconds", seconds))
+	return false
+}
+
+type RateLimitRule struct {
+	// empty matches all methods
+	Method string
+
+	// path prefix matched by segments, "/api" matches "/api/x" but not "/apix".
+	// the longest match wins
+	Path string
+
+	Limiter RateLimiter
+	KeyFunc KeyFunc
+}
+
+/*
+RateLimitByRoute applies the rule matching the request,
+requests matching no rule are not limited
+*/
+func RateLimitByRoute(rules []RateLimitRule) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var matched *RateLimitRule
+			for i, v := range rules {
+				if v.Method != "" && v.Method != r.Method {
+					continue
+				}
+				if !matchPathPrefix(v.Path, r.URL.Path) {
+					continue
+				}
+				if matched == nil || len(v.Path) > len(matched.Path) {
+					matched = &rules[i]
+				}
+			}
+			if matched != nil && !checkRateLimit(w, r, matched.Limiter, matched.KeyFunc) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(T *testing.T) {
+	now := time.Unix(1000, 0)
+	tb := NewTokenBucket(1, 2, 0)
+	tb.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := tb.Allow("a"); !ok {
+			T.Fatalf("request %v denied", i)
+		}
+	}
+	ok, wait := tb.Allow("a")
+	if ok || wait != time.Second {
+		T.Fatalf("expect denied with 1s wait, got %v %v", ok, wait)
+	}
+	if ok, _ := tb.Allow("b"); !ok {
+		T.Fatal("other key denied")
+	}
+	now = now.Add(time.Second)
+	if ok, _ := tb.Allow("a"); !ok {
+		T.Fatal("not refilled")
+	}
+}
+
+func TestSlidingWindow(T *testing.T) {
+	now := time.Unix(1000, 0)
+	sw := NewSlidingWindow(2, 10*time.Second, 0)
+	sw.now = func() time.Time { return now }
+
+	sw.Allow("a")
+	sw.Allow("a")
+	if ok, _ := sw.Allow("a"); ok {
+		T.Fatal("limit exceeded")
+	}
+	// half of the previous window still counts
+	now = now.Add(15 * time.Second)
+	if ok, _ := sw.Allow("a"); !ok {
+		T.Fatal("denied in new window")
+	}
+	ok, wait := sw.Allow("a")
+	if ok {
+		T.Fatal("previous window ignored")
+	}
+	now = now.Add(wait)
+	if ok, _ := sw.Allow("a"); !ok {
+		T.Fatalf("denied after waiting %v", wait)
+	}
+}
+
+func TestRateStoreEviction(T *testing.T) {
+	s := newRateStore[int](time.Minute, 2)
+	now := time.Unix(1000, 0)
+	s.do("a", now, func(*int) {})
+	s.do("b", now.Add(time.Second), func(*int) {})
+	s.do("c", now.Add(2*time.Second), func(*int) {})
+	if s.Len() != 2 {
+		T.Fatalf("maxKeys not kept: %v", s.Len())
+	}
+	s.do("d", now.Add(2*time.Minute), func(*int) {})
+	if s.Len() != 1 {
+		T.Fatalf("idle keys not evicted: %v", s.Len())
+	}
+}
+
+func TestRateLimitMiddleware(T *testing.T) {
+	handler := RateLimit(NewTokenBucket(1, 1, 0), KeyByIP)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			RespondSuccess(w)
+		}))
+	for i, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != code {
+			T.Fatalf("request %v: expect %v, got %v", i, code, w.Code)
+		}
+		if code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+			T.Fatalf("wrong Retry-After: %v", w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestKeyByUsername(T *testing.T) {
+	body := `{"username":"alice","data":"` + strings.Repeat("x", 100) + `"}`
+	for _, limit := range []int64{int64(len(body)), 16} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		key := KeyByUsername(limit)(r)
+		if limit > 16 && key != "alice" {
+			T.Errorf("limit %v: wrong key %q", limit, key)
+		}
+		rest, _ := io.ReadAll(r.Body)
+		if string(rest) != body {
+			T.Errorf("limit %v: body not restored: %s", limit, rest)
+		}
+	}
+}
+
+func TestRateLimitByRoute(T *testing.T) {
+	handler := RateLimitByRoute([]RateLimitRule{
+		{Path: "/api", Limiter: NewTokenBucket(1, 1, 0), KeyFunc: KeyByIP},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondSuccess(w)
+	}))
+	for i, v := range []struct {
+		path string
+		code int
+	}{
+		{"/api/x", http.StatusOK},
+		{"/api", http.StatusTooManyRequests},
+		{"/apix", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, v.path, nil))
+		if w.Code != v.code {
+			T.Errorf("request %v %v: expect %v, got %v", i, v.path, v.code, w.Code)
+		}
+	}
+}
+
+func TestTokenBucketInvalid(T *testing.T) {
+	for _, v := range [][2]float64{{0, 1}, {1, 0}, {-1, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					T.Errorf("rate %v, burst %v should panic", v[0], v[1])
+				}
+			}()
+			NewTokenBucket(v[0], int(v[1]), 0)
+		}()
+	}
+}
@@ -0,0 +1,224 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+
+	wsnet "github.com/wsva/lib_go/net"
+)
+
+const RedactedValue = "REDACTED"
+
+// DefaultRedactHeaders are redacted by Recorder if RedactHeaders is nil
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+/*
+Interaction is one recorded exchange.
+Request and Response are in http wire format, readable in fixture files.
+*/
+type Interaction struct {
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Request  string `json:"request"`
+	Response string `json:"response"`
+}
+
+// Cassette is the content of a fixture file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+func LoadCassette(filename string) (*Cassette, error) {
+	contentBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	err = json.Unmarshal(contentBytes, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Cassette) Save(filename string) error {
+	jsonBytes, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, jsonBytes, 0644)
+}
+
+/*
+Recorder captures real exchanges, and saves them as a fixture file
+
+	recorder := NewRecorder("testdata/users.json")
+	client := HttpClient{Address: url, Method: http.MethodGet, WrapTransport: recorder.Wrap}
+	client.DoRequest()
+	recorder.Save()
+*/
+type Recorder struct {
+	Filename string
+
+	// values of these headers are replaced by RedactedValue,
+	// DefaultRedactHeaders if nil
+	RedactHeaders []string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func NewRecorder(filename string) *Recorder {
+	return &Recorder{Filename: filename}
+}
+
+func (r *Recorder) Wrap(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return r.roundTrip(base, req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func (r *Recorder) redact(h http.Header) http.Header {
+	result := h.Clone()
+	if result == nil {
+		result = make(http.Header)
+	}
+	names := r.RedactHeaders
+	if names == nil {
+		names = DefaultRedactHeaders
+	}
+	for _, v := range names {
+		if values := result.Values(v); len(values) > 0 {
+			for i := range values {
+				values[i] = RedactedValue
+			}
+			result[http.CanonicalHeaderKey(v)] = values
+		}
+	}
+	return result
+}
+
+func (r *Recorder) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	dumpReq := req.Clone(req.Context())
+	dumpReq.Header = r.redact(req.Header)
+	dumpReq.Body = io.NopCloser(bytes.NewReader(body))
+	requestString := wsnet.GetRequestString(dumpReq)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	dumpResp := *resp
+	dumpResp.Header = r.redact(resp.Header)
+	responseBytes, err := httputil.DumpResponse(&dumpResp, true)
+	// DumpResponse restores the body of dumpResp
+	resp.Body = dumpResp.Body
+	if err != nil {
+		return resp, nil
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Request:  requestString,
+		Response: string(responseBytes),
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Save writes all recorded interactions to Filename
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.Filename)
+}
+
+/*
+Replayer serves recorded interactions without network.
+
+requests are matched by method and url. repeated requests get the
+recorded responses in order, and the last one after that.
+unmatched requests fail.
+*/
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+	used         map[string]int
+}
+
+func NewReplayer(filename string) (*Replayer, error) {
+	c, err := LoadCassette(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &Replayer{
+		interactions: make(map[string][]Interaction),
+		used:         make(map[string]int),
+	}
+	for _, v := range c.Interactions {
+		key := v.Method + " " + v.URL
+		p.interactions[key] = append(p.interactions[key], v)
+	}
+	return p, nil
+}
+
+// Wrap ignores base, so it can be used as HttpClient.WrapTransport
+func (p *Replayer) Wrap(base http.RoundTripper) http.RoundTripper {
+	return p
+}
+
+func (p *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	key := req.Method + " " + req.URL.String()
+	p.mu.Lock()
+	list := p.interactions[key]
+	if len(list) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no recorded interaction for %v", key)
+	}
+	i := p.used[key]
+	if i >= len(list) {
+		i = len(list) - 1
+	} else {
+		p.used[key]++
+	}
+	p.mu.Unlock()
+	return http.ReadResponse(bufio.NewReader(strings.NewReader(list[i].Response)), req)
+}
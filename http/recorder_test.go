@@ -0,0 +1,85 @@
+package http_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestRecorderReplayer(T *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		w.Header().Set("Set-Cookie", "session=secret")
+		fmt.Fprintf(w, "%v %v", r.URL.Path, n)
+	}))
+	url := server.URL
+
+	filename := filepath.Join(T.TempDir(), "cassette.json")
+	recorder := wshttp.NewRecorder(filename)
+	for i := 0; i < 2; i++ {
+		client := wshttp.HttpClient{
+			Address:       url + "/users",
+			Method:        http.MethodPost,
+			Data:          strings.NewReader(`{"name":"a"}`),
+			HeaderMap:     map[string]string{"Authorization": "Bearer secret"},
+			WrapTransport: recorder.Wrap,
+		}
+		_, err := client.DoRequest()
+		if err != nil {
+			T.Fatal(err)
+		}
+	}
+	err := recorder.Save()
+	if err != nil {
+		T.Fatal(err)
+	}
+	server.Close()
+
+	contentBytes, err := os.ReadFile(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if strings.Contains(string(contentBytes), "secret") {
+		T.Errorf("secret not redacted: %s", contentBytes)
+	}
+	if !strings.Contains(string(contentBytes), `{\"name\":\"a\"}`) {
+		T.Errorf("request body not recorded: %s", contentBytes)
+	}
+
+	replayer, err := wshttp.NewReplayer(filename)
+	if err != nil {
+		T.Fatal(err)
+	}
+	for _, want := range []string{"/users 1", "/users 2", "/users 2"} {
+		client := wshttp.HttpClient{
+			Address:       url + "/users",
+			Method:        http.MethodPost,
+			Data:          strings.NewReader(`{"name":"a"}`),
+			WrapTransport: replayer.Wrap,
+		}
+		resp, err := client.DoRequest()
+		if err != nil {
+			T.Fatal(err)
+		}
+		if string(resp) != want {
+			T.Errorf("got %q, want %q", resp, want)
+		}
+	}
+
+	client := wshttp.HttpClient{
+		Address:       url + "/other",
+		Method:        http.MethodGet,
+		WrapTransport: replayer.Wrap,
+	}
+	if _, err := client.DoRequest(); err == nil {
+		T.Error("expected error for unrecorded request")
+	}
+}
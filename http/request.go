@@ -20,6 +20,7 @@ func (r *Request) Reader() *bytes.Reader {
 	return bytes.NewReader(jsonBytes)
 }
 
+// ParseRequest returns error if body is not empty and not a valid Request
 func ParseRequest(r *http.Request, limit int64) (*Request, error) {
 	defer r.Body.Close()
 	body, err := io.ReadAll(io.LimitReader(r.Body, limit))
@@ -27,7 +28,12 @@ func ParseRequest(r *http.Request, limit int64) (*Request, error) {
 		return nil, err
 	}
 	var req Request
-	json.Unmarshal(body, &req)
+	if len(bytes.TrimSpace(body)) > 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			return nil, err
+		}
+	}
 	req.IP = net.GetIPFromRequest(r).String()
 	return &req, nil
 }
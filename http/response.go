@@ -3,7 +3,6 @@ package http
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 )
 
@@ -40,20 +39,46 @@ type Response struct {
 	Host string `json:"host,omitempty"`
 }
 
+/*
+DoResponse writes r as json.
+
+if TraceId is empty and the RequestID middleware is in use,
+TraceId and Host are populated from the request id
+*/
 func (r *Response) DoResponse(w http.ResponseWriter) {
+	if r.TraceId == "" {
+		if id := w.Header().Get(HeaderRequestID); id != "" {
+			r.TraceId = id
+			if r.Host == "" {
+				r.Host = hostname
+			}
+		}
+	}
 	jsonBytes, _ := json.Marshal(*r)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonBytes)
 }
 
+/*
+RespondError responds err with the http status of err, see NewErrorResponse
+*/
 func RespondError(w http.ResponseWriter, err any) {
-	resp := Response{
-		Success: false,
-		ErrMsg:  fmt.Sprint(err),
+	resp, status := NewErrorResponse(err)
+	if status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
 	}
 	resp.DoResponse(w)
 }
 
+// RespondErrorStatus is like RespondError, with http status code
+func RespondErrorStatus(w http.ResponseWriter, status int, err any) {
+	resp, _ := NewErrorResponse(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	resp.DoResponse(w)
+}
+
 func RespondSuccess(w http.ResponseWriter) {
 	resp := Response{
 		Success: true,
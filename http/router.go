@@ -0,0 +1,328 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Router matches method and path, with named path parameters
+
+	router := NewRouter()
+	router.Use(Recover(l), RequestID())
+	router.GET("/users/:id", getUser)
+	api := router.Group("/api", Wrap(CheckClientCertExist))
+	api.POST("/files/*path", uploadFile)
+
+":name" matches one segment, "*name" matches the rest of the path.
+static segments take priority over parameters.
+trailing slashes are ignored.
+*/
+type Router struct {
+	routes      []*route
+	middlewares Chain
+
+	// default responds 404 in Response
+	NotFound http.Handler
+
+	// default responds 405 in Response, Allow header is already set
+	MethodNotAllowed http.Handler
+
+	handler http.Handler
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.Handler
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Use adds middlewares for all requests, including 404 and 405
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = r.middlewares.Append(middlewares...)
+	r.handler = r.middlewares.Then(http.HandlerFunc(r.dispatch))
+}
+
+func (r *Router) Handle(method, pattern string, handler http.Handler) {
+	segments := splitPath(pattern)
+	for i, v := range segments {
+		if strings.HasPrefix(v, "*") && i != len(segments)-1 {
+			panic(fmt.Sprintf("catch-all must be the last segment: %v", pattern))
+		}
+	}
+	r.routes = append(r.routes, &route{
+		method:   strings.ToUpper(method),
+		pattern:  "/" + strings.Join(segments, "/"),
+		segments: segments,
+		handler:  handler,
+	})
+	// more static segments first, so /users/new wins over /users/:id
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].rank() > r.routes[j].rank()
+	})
+}
+
+func (r *Router) HandleFunc(method, pattern string, f http.HandlerFunc) {
+	r.Handle(method, pattern, f)
+}
+
+func (r *Router) GET(pattern string, f http.HandlerFunc) {
+	r.Handle(http.MethodGet, pattern, f)
+}
+
+func (r *Router) POST(pattern string, f http.HandlerFunc) {
+	r.Handle(http.MethodPost, pattern, f)
+}
+
+func (r *Router) PUT(pattern string, f http.HandlerFunc) {
+	r.Handle(http.MethodPut, pattern, f)
+}
+
+func (r *Router) PATCH(pattern string, f http.HandlerFunc) {
+	r.Handle(http.MethodPatch, pattern, f)
+}
+
+func (r *Router) DELETE(pattern string, f http.HandlerFunc) {
+	r.Handle(http.MethodDelete, pattern, f)
+}
+
+// Group returns a RouteGroup under prefix, with extra middlewares
+func (r *Router) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:      r,
+		prefix:      "/" + strings.Join(splitPath(prefix), "/"),
+		middlewares: NewChain(middlewares...),
+	}
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.handler == nil {
+		r.dispatch(w, req)
+		return
+	}
+	r.handler.ServeHTTP(w, req)
+}
+
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	path := splitPath(req.URL.Path)
+	var allowed []string
+	var headRoute *route
+	var headParams map[string]string
+	for _, v := range r.routes {
+		params, ok := v.match(path)
+		if !ok {
+			continue
+		}
+		if v.method == req.Method {
+			r.serve(w, req, v, params)
+			return
+		}
+		if req.Method == http.MethodHead && v.method == http.MethodGet && headRoute == nil {
+			headRoute, headParams = v, params
+		}
+		allowed = append(allowed, v.method)
+	}
+	if headRoute != nil {
+		r.serve(w, req, headRoute, headParams)
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(uniqueStrings(allowed), ", "))
+		if r.MethodNotAllowed != nil {
+			r.MethodNotAllowed.ServeHTTP(w, req)
+			return
+		}
+		RespondError(w, ErrMethodNotAllowed)
+		return
+	}
+	if r.NotFound != nil {
+		r.NotFound.ServeHTTP(w, req)
+		return
+	}
+	RespondError(w, ErrNotFound)
+}
+
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, rt *route, params map[string]string) {
+	if len(params) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyPathParams, params))
+	}
+	// reported to the Metrics middleware
+	if p, ok := req.Context().Value(contextKeyRoute).(*string); ok {
+		*p = rt.pattern
+	}
+	rt.handler.ServeHTTP(w, req)
+}
+
+func (rt *route) rank() int {
+	rank := 0
+	for _, v := range rt.segments {
+		switch v[0] {
+		case ':':
+			rank += 1
+		case '*':
+		default:
+			rank += 2
+		}
+	}
+	return rank
+}
+
+func (rt *route) match(path []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, v := range rt.segments {
+		if v[0] == '*' {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[v[1:]] = strings.Join(path[i:], "/")
+			return params, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		if v[0] == ':' {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[v[1:]] = path[i]
+			continue
+		}
+		if v != path[i] {
+			return nil, false
+		}
+	}
+	return params, len(path) == len(rt.segments)
+}
+
+func splitPath(path string) []string {
+	var result []string
+	for _, v := range strings.Split(path, "/") {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func uniqueStrings(list []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// RouteGroup registers routes under a prefix, with shared middlewares
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares Chain
+}
+
+func (g *RouteGroup) Use(middlewares ...Middleware) {
+	g.middlewares = g.middlewares.Append(middlewares...)
+}
+
+// Group returns a sub group, inheriting the middlewares of g
+func (g *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:      g.router,
+		prefix:      strings.TrimSuffix(g.prefix, "/") + "/" + strings.Join(splitPath(prefix), "/"),
+		middlewares: g.middlewares.Append(middlewares...),
+	}
+}
+
+// Handle uses the middlewares of g at the time of calling
+func (g *RouteGroup) Handle(method, pattern string, handler http.Handler) {
+	g.router.Handle(method, g.prefix+"/"+pattern, g.middlewares.Then(handler))
+}
+
+func (g *RouteGroup) HandleFunc(method, pattern string, f http.HandlerFunc) {
+	g.Handle(method, pattern, f)
+}
+
+func (g *RouteGroup) GET(pattern string, f http.HandlerFunc) {
+	g.Handle(http.MethodGet, pattern, f)
+}
+
+func (g *RouteGroup) POST(pattern string, f http.HandlerFunc) {
+	g.Handle(http.MethodPost, pattern, f)
+}
+
+func (g *RouteGroup) PUT(pattern string, f http.HandlerFunc) {
+	g.Handle(http.MethodPut, pattern, f)
+}
+
+func (g *RouteGroup) PATCH(pattern string, f http.HandlerFunc) {
+	g.Handle(http.MethodPatch, pattern, f)
+}
+
+func (g *RouteGroup) DELETE(pattern string, f http.HandlerFunc) {
+	g.Handle(http.MethodDelete, pattern, f)
+}
+
+// PathParam returns the named path parameter, or empty
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(contextKeyPathParams).(map[string]string)
+	return params[name]
+}
+
+func PathParamInt(r *http.Request, name string) (int, error) {
+	value := PathParam(r, name)
+	if value == "" {
+		return 0, ErrBadRequest.WithMessage("missing path parameter: %v", name)
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, ErrBadRequest.WithMessage("invalid path parameter %v: %v", name, value)
+	}
+	return result, nil
+}
+
+// QueryString returns the first value of key, or def if missing
+func QueryString(r *http.Request, key, def string) string {
+	values, ok := r.URL.Query()[key]
+	if !ok || len(values) == 0 {
+		return def
+	}
+	return values[0]
+}
+
+// QueryInt returns def if missing, and error if not an int
+func QueryInt(r *http.Request, key string, def int) (int, error) {
+	value := QueryString(r, key, "")
+	if value == "" {
+		return def, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return def, ErrBadRequest.WithMessage("invalid query parameter %v: %v", key, value)
+	}
+	return result, nil
+}
+
+// QueryBool returns def if missing, and error if not a bool
+func QueryBool(r *http.Request, key string, def bool) (bool, error) {
+	value := QueryString(r, key, "")
+	if value == "" {
+		return def, nil
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return def, ErrBadRequest.WithMessage("invalid query parameter %v: %v", key, value)
+	}
+	return result, nil
+}
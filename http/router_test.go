@@ -0,0 +1,69 @@
+package http_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestRouter(T *testing.T) {
+	reply := func(format string, names ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			args := make([]any, len(names))
+			for i, v := range names {
+				args[i] = wshttp.PathParam(r, v)
+			}
+			fmt.Fprintf(w, format, args...)
+		}
+	}
+	tagged := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Group", "api")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	router := wshttp.NewRouter()
+	router.GET("/users/:id", reply("user %v", "id"))
+	router.GET("/users/new", reply("new user"))
+	router.DELETE("/users/:id", reply("delete %v", "id"))
+	api := router.Group("/api", tagged)
+	api.POST("/files/*path", reply("file %v", "path"))
+
+	cases := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/users/42", http.StatusOK, "user 42"},
+		{http.MethodGet, "/users/new/", http.StatusOK, "new user"},
+		{http.MethodDelete, "/users/42", http.StatusOK, "delete 42"},
+		{http.MethodPost, "/api/files/a/b.txt", http.StatusOK, "file a/b.txt"},
+		{http.MethodPut, "/users/42", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/nothing", http.StatusNotFound, ""},
+	}
+	for i, v := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(v.method, v.path, nil))
+		if w.Code != v.code {
+			T.Errorf("case %v: expect %v, got %v", i, v.code, w.Code)
+		}
+		if v.body != "" && w.Body.String() != v.body {
+			T.Errorf("case %v: expect %q, got %q", i, v.body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/1", nil))
+	if w.Header().Get("Allow") != "GET, DELETE" {
+		T.Errorf("wrong Allow: %v", w.Header().Get("Allow"))
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/files/x", nil))
+	if w.Header().Get("X-Group") != "api" {
+		T.Error("group middleware not applied")
+	}
+}
@@ -0,0 +1,252 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultMaxHeaderBytes    = 1 << 20
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+/*
+Server serves one handler on every enabled ListenInfo, plain http and https
+listeners together, and shuts down gracefully when the context is done.
+
+	s := &Server{
+		ListenList:    []ListenInfo{{Enable: true, Port: 80, Protocol: "http"}, {Enable: true, Port: 443, Protocol: "https"}},
+		ServerCrtFile: "server.crt",
+		ServerKeyFile: "server.key",
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	err := s.Serve(ctx, handler)
+
+zero values of the timeout fields are replaced by the Default* constants
+*/
+type Server struct {
+	ListenList []ListenInfo `json:"ListenList"`
+
+	// used only by https listeners
+	ServerCrtFile string `json:"ServerCrtFile"`
+	ServerKeyFile string `json:"ServerKeyFile"`
+
+	// used only by mutual mode
+	// DO NOT set this field, when you don't want to use mutual https
+	CACrtFile string `json:"CACrtFile"`
+
+	ReadTimeout       time.Duration `json:"ReadTimeout"`
+	ReadHeaderTimeout time.Duration `json:"ReadHeaderTimeout"`
+	WriteTimeout      time.Duration `json:"WriteTimeout"`
+	IdleTimeout       time.Duration `json:"IdleTimeout"`
+	MaxHeaderBytes    int           `json:"MaxHeaderBytes"`
+
+	// max time to wait for in-flight requests after the context is done
+	ShutdownTimeout time.Duration `json:"ShutdownTimeout"`
+
+	once      sync.Once
+	ready     chan struct{}
+	readyOnce sync.Once
+	mu        sync.Mutex
+	servers   []*http.Server
+	addrs     []net.Addr
+}
+
+func (s *Server) init() {
+	s.once.Do(func() {
+		s.ready = make(chan struct{})
+	})
+}
+
+/*
+Ready is closed once the first Serve has bound all listeners,
+or has failed to, then Addrs is empty and Serve returns the error.
+*/
+func (s *Server) Ready() <-chan struct{} {
+	s.init()
+	return s.ready
+}
+
+// Addrs returns the bound addresses, useful when Port is 0
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]net.Addr(nil), s.addrs...)
+}
+
+func (s *Server) newHttpServer(handler http.Handler) *http.Server {
+	server := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       s.ReadTimeout,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+	}
+	if server.ReadTimeout == 0 {
+		server.ReadTimeout = DefaultReadTimeout
+	}
+	if server.ReadHeaderTimeout == 0 {
+		server.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if server.WriteTimeout == 0 {
+		server.WriteTimeout = DefaultWriteTimeout
+	}
+	if server.IdleTimeout == 0 {
+		server.IdleTimeout = DefaultIdleTimeout
+	}
+	if server.MaxHeaderBytes == 0 {
+		server.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	return server
+}
+
+/*
+Serve binds all enabled listeners, closes Ready, and blocks until ctx is done
+or one of the listeners fails. Then it shuts down all listeners, waiting at
+most ShutdownTimeout for in-flight requests.
+
+returns nil after a graceful shutdown
+*/
+func (s *Server) Serve(ctx context.Context, handler http.Handler) error {
+	s.init()
+	// Serve can be called again after it returns
+	markReady := func() { s.readyOnce.Do(func() { close(s.ready) }) }
+	// also on bind failure, so waiting on Ready never blocks forever
+	defer markReady()
+
+	var tlsConfig *tls.Config
+	var listenerList []net.Listener
+	closeAll := func() {
+		for _, v := range listenerList {
+			v.Close()
+		}
+	}
+	for _, v := range s.ListenList {
+		if !v.Enable {
+			continue
+		}
+		protocol := v.LowercaseProtocol()
+		if protocol != "http" && protocol != "https" {
+			closeAll()
+			return fmt.Errorf("unsupported protocol: %v", v.Protocol)
+		}
+		ln, err := net.Listen("tcp", v.ListenAddress())
+		if err != nil {
+			closeAll()
+			return err
+		}
+		if protocol == "https" {
+			if tlsConfig == nil {
+				tlsConfig, err = newServerTLSConfig(s.ServerCrtFile, s.ServerKeyFile, s.CACrtFile)
+				if err != nil {
+					ln.Close()
+					closeAll()
+					return err
+				}
+			}
+			ln = tls.NewListener(ln, tlsConfig)
+		}
+		listenerList = append(listenerList, ln)
+	}
+	if len(listenerList) == 0 {
+		return errors.New("no listener enabled")
+	}
+
+	s.mu.Lock()
+	s.servers = nil
+	s.addrs = nil
+	for _, v := range listenerList {
+		s.servers = append(s.servers, s.newHttpServer(handler))
+		s.addrs = append(s.addrs, v.Addr())
+	}
+	servers := s.servers
+	s.mu.Unlock()
+
+	errCh := make(chan error, len(servers))
+	for i := range servers {
+		go func(server *http.Server, ln net.Listener) {
+			err := server.Serve(ln)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errCh <- err
+		}(servers[i], listenerList[i])
+	}
+	markReady()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errCh:
+	}
+
+	shutdownErr := s.Shutdown(context.Background())
+	if serveErr != nil {
+		return serveErr
+	}
+	return shutdownErr
+}
+
+// Shutdown gracefully stops all listeners, waiting at most ShutdownTimeout
+func (s *Server) Shutdown(ctx context.Context) error {
+	timeout := s.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s.mu.Lock()
+	servers := s.servers
+	s.mu.Unlock()
+
+	errList := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, v := range servers {
+		wg.Add(1)
+		go func(i int, server *http.Server) {
+			defer wg.Done()
+			errList[i] = server.Shutdown(ctx)
+			if errList[i] != nil {
+				server.Close()
+			}
+		}(i, v)
+	}
+	wg.Wait()
+	return errors.Join(errList...)
+}
+
+func newServerTLSConfig(crtFile, keyFile, caCrtFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if len(caCrtFile) > 0 {
+		caPool := x509.NewCertPool()
+		crt, err := os.ReadFile(caCrtFile)
+		if err != nil {
+			return nil, err
+		}
+		caPool.AppendCertsFromPEM(crt)
+		config.ClientCAs = caPool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
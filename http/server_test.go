@@ -0,0 +1,79 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestServer(T *testing.T) {
+	s := &wshttp.Server{
+		ListenList:      []wshttp.ListenInfo{{Enable: true, Port: 0, Protocol: "HTTP"}},
+		ShutdownTimeout: 5 * time.Second,
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, handler)
+	}()
+	<-s.Ready()
+
+	url := fmt.Sprintf("http://%v/", s.Addrs()[0])
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respCh <- string(body)
+	}()
+
+	// shut down while the request is in flight
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if body := <-respCh; body != "ok" {
+		T.Fatalf("in-flight request not drained: %v", body)
+	}
+	if err := <-done; err != nil {
+		T.Fatal(err)
+	}
+
+	// Ready is closed even if binding fails
+	failed := &wshttp.Server{ListenList: []wshttp.ListenInfo{{Enable: true, Port: 0, Protocol: "ftp"}}}
+	if err := failed.Serve(context.Background(), handler); err == nil {
+		T.Fatal("unsupported protocol should fail")
+	}
+	select {
+	case <-failed.Ready():
+	case <-time.After(time.Second):
+		T.Fatal("Ready not closed after bind failure")
+	}
+	if len(failed.Addrs()) != 0 {
+		T.Fatalf("addrs after bind failure: %v", failed.Addrs())
+	}
+
+	// serve again after shutdown
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		done <- s.Serve(ctx, handler)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		T.Fatal(err)
+	}
+}
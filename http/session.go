@@ -0,0 +1,588 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	wl_crypto "github.com/wsva/lib_go/crypto"
+	"github.com/wsva/lib_go/logger"
+)
+
+const (
+	DefaultSessionCookieName      = "session"
+	DefaultSessionIdleTimeout     = 30 * time.Minute
+	DefaultSessionAbsoluteTimeout = 24 * time.Hour
+)
+
+const (
+	HeaderCSRFToken = "X-CSRF-Token"
+	FormCSRFToken   = "csrf_token"
+)
+
+// browsers drop larger cookies
+const maxCookieValueSize = 4000
+
+var ErrCSRFInvalid = RegisterError("CSRF_INVALID", http.StatusForbidden, "invalid csrf token", ShowTypeError)
+
+var ErrSessionTooLarge = errors.New("session too large for cookie, use a SessionStore")
+
+var regexpSessionID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+/*
+SessionStore keeps sessions on the server side, only the id is in the cookie.
+Load returns nil, nil if id is not found or expired.
+*/
+type SessionStore interface {
+	Load(id string) ([]byte, error)
+	Save(id string, data []byte, expiresAt time.Time) error
+	Delete(id string) error
+}
+
+type memorySession struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// MemorySessionStore is lost on restart, and not shared between instances
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	items     map[string]memorySession
+	lastSweep time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{items: make(map[string]memorySession)}
+}
+
+func (s *MemorySessionStore) Load(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(item.expiresAt) {
+		delete(s.items, id)
+		return nil, nil
+	}
+	return item.data, nil
+}
+
+func (s *MemorySessionStore) Save(id string, data []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// expired sessions are removed once a minute
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, v := range s.items {
+			if now.After(v.expiresAt) {
+				delete(s.items, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.items[id] = memorySession{data: append([]byte(nil), data...), expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+/*
+FileSessionStore keeps one file per session in Dir.
+expired files are removed on Load, or by Cleanup.
+*/
+type FileSessionStore struct {
+	Dir string
+}
+
+type fileSession struct {
+	ExpiresAt time.Time `json:"ExpiresAt"`
+	Data      []byte    `json:"Data"`
+}
+
+func NewFileSessionStore(dir string) *FileSessionStore {
+	return &FileSessionStore{Dir: dir}
+}
+
+func (s *FileSessionStore) filename(id string) (string, error) {
+	if !regexpSessionID.MatchString(id) {
+		return "", errors.New("invalid session id")
+	}
+	return filepath.Join(s.Dir, id), nil
+}
+
+func (s *FileSessionStore) Load(id string) ([]byte, error) {
+	filename, err := s.filename(id)
+	if err != nil {
+		return nil, err
+	}
+	contentBytes, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var fs fileSession
+	err = json.Unmarshal(contentBytes, &fs)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(fs.ExpiresAt) {
+		os.Remove(filename)
+		return nil, nil
+	}
+	return fs.Data, nil
+}
+
+func (s *FileSessionStore) Save(id string, data []byte, expiresAt time.Time) error {
+	filename, err := s.filename(id)
+	if err != nil {
+		return err
+	}
+	jsonBytes, err := json.Marshal(fileSession{ExpiresAt: expiresAt, Data: data})
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.Dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(jsonBytes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+func (s *FileSessionStore) Delete(id string) error {
+	filename, err := s.filename(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Cleanup removes expired sessions, call it periodically
+func (s *FileSessionStore) Cleanup() error {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	for _, v := range entries {
+		if regexpSessionID.MatchString(v.Name()) {
+			// Load removes expired files
+			s.Load(v.Name())
+		}
+	}
+	return nil
+}
+
+/*
+Session is loaded by SessionManager.Middleware, get it by GetSession.
+it is saved when the response header is written, if saving fails,
+500 is responded instead of the response of the handler.
+*/
+type Session struct {
+	ID         string            `json:"id"`
+	Values     map[string]string `json:"values"`
+	CSRF       string            `json:"csrf,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	LastAccess time.Time         `json:"lastAccess"`
+
+	mu        sync.Mutex
+	isNew     bool
+	modified  bool
+	destroyed bool
+	// deleted from store on save, after RenewID
+	oldIDs []string
+}
+
+func (s *Session) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Values[key]
+}
+
+func (s *Session) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Values == nil {
+		s.Values = make(map[string]string)
+	}
+	s.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Values, key)
+	s.modified = true
+}
+
+/*
+RenewID changes the id and the csrf token, and keeps the values.
+call it on login and privilege change, against session fixation.
+the absolute timeout still counts from the creation of the session.
+*/
+func (s *Session) RenewID() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+	csrf, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+	if !s.isNew {
+		s.oldIDs = append(s.oldIDs, s.ID)
+	}
+	s.ID = id
+	s.CSRF = csrf
+	s.modified = true
+	return nil
+}
+
+/*
+Destroy removes the session from the store and the cookie, on logout.
+without a SessionStore, a copied cookie stays valid until it expires.
+*/
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Values = nil
+	s.destroyed = true
+}
+
+// CSRFToken returns the csrf token of the session, generated if missing
+func (s *Session) CSRFToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.CSRF == "" {
+		csrf, err := newCSRFToken()
+		if err != nil {
+			return "", err
+		}
+		s.CSRF = csrf
+		s.modified = true
+	}
+	return s.CSRF, nil
+}
+
+func (s *Session) checkCSRF(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.CSRF != "" && subtle.ConstantTimeCompare([]byte(s.CSRF), []byte(token)) == 1
+}
+
+// GetSession returns nil if SessionManager.Middleware is not used
+func GetSession(r *http.Request) *Session {
+	s, _ := r.Context().Value(contextKeySession).(*Session)
+	return s
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+SessionManager keeps sessions in encrypted and authenticated cookies.
+
+with a Store, the cookie holds only the session id,
+otherwise the whole session is in the cookie, limited to about 4KB.
+
+	sessions := NewSessionManager(key, NewFileSessionStore("/var/lib/app/sessions"))
+	router.Use(sessions.Middleware(), CSRF())
+
+	s := GetSession(r)
+	s.RenewID()
+	s.Set("username", username)
+
+new sessions without values are not saved, so anonymous requests
+do not fill the store.
+*/
+type SessionManager struct {
+	// cookies are encrypted by crypto.AESGCMEncrypt with Key
+	Key   string
+	Store SessionStore
+
+	CookieName string // default DefaultSessionCookieName
+	Path       string // default "/"
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite // default http.SameSiteLaxMode
+
+	// default DefaultSessionIdleTimeout and DefaultSessionAbsoluteTimeout
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	// logs store errors, optional
+	Logger logger.Logger
+}
+
+func NewSessionManager(key string, store SessionStore) *SessionManager {
+	return &SessionManager{
+		Key:             key,
+		Store:           store,
+		CookieName:      DefaultSessionCookieName,
+		Path:            "/",
+		SameSite:        http.SameSiteLaxMode,
+		IdleTimeout:     DefaultSessionIdleTimeout,
+		AbsoluteTimeout: DefaultSessionAbsoluteTimeout,
+	}
+}
+
+func (m *SessionManager) cookieName() string {
+	if m.CookieName == "" {
+		return DefaultSessionCookieName
+	}
+	return m.CookieName
+}
+
+func (m *SessionManager) cookiePath() string {
+	if m.Path == "" {
+		return "/"
+	}
+	return m.Path
+}
+
+func (m *SessionManager) timeouts() (time.Duration, time.Duration) {
+	idle, absolute := m.IdleTimeout, m.AbsoluteTimeout
+	if idle <= 0 {
+		idle = DefaultSessionIdleTimeout
+	}
+	if absolute <= 0 {
+		absolute = DefaultSessionAbsoluteTimeout
+	}
+	return idle, absolute
+}
+
+func (m *SessionManager) logError(format string, args ...any) {
+	if m.Logger != nil {
+		m.Logger.Error(format, args...)
+	}
+}
+
+func (m *SessionManager) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, err := m.load(r)
+			if err != nil {
+				RespondError(w, ErrInternal.Wrap(err))
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			sw.beforeHeader = func() {
+				err := m.save(sw, s)
+				if err == nil {
+					return
+				}
+				m.logError("save session: %v", err)
+				sw.Header().Del("Set-Cookie")
+				RespondError(sw.ResponseWriter, ErrInternal.Wrap(err))
+				sw.status = http.StatusInternalServerError
+				sw.discard = true
+			}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), contextKeySession, s)))
+			sw.callBeforeHeader()
+		})
+	}
+}
+
+// load returns a new session if the cookie is missing, invalid or expired
+func (m *SessionManager) load(r *http.Request) (*Session, error) {
+	if s := m.loadCookie(r); s != nil {
+		return s, nil
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Session{
+		ID:         id,
+		CreatedAt:  now,
+		LastAccess: now,
+		isNew:      true,
+	}, nil
+}
+
+func (m *SessionManager) loadCookie(r *http.Request) *Session {
+	cookie, err := r.Cookie(m.cookieName())
+	if err != nil {
+		return nil
+	}
+	ctext, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	payload, err := wl_crypto.AESGCMDecrypt(m.Key, ctext, []byte(m.cookieName()))
+	if err != nil {
+		return nil
+	}
+	if m.Store != nil {
+		id := string(payload)
+		payload, err = m.Store.Load(id)
+		if err != nil {
+			m.logError("load session: %v", err)
+			return nil
+		}
+		if payload == nil {
+			return nil
+		}
+	}
+	var s Session
+	err = json.Unmarshal(payload, &s)
+	if err != nil {
+		return nil
+	}
+	idle, absolute := m.timeouts()
+	now := time.Now()
+	if now.Sub(s.LastAccess) > idle || now.Sub(s.CreatedAt) > absolute {
+		if m.Store != nil {
+			m.Store.Delete(s.ID)
+		}
+		return nil
+	}
+	return &s
+}
+
+func (m *SessionManager) save(w http.ResponseWriter, s *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.Store != nil {
+		for _, v := range s.oldIDs {
+			m.Store.Delete(v)
+		}
+		s.oldIDs = nil
+	}
+	if s.destroyed {
+		if m.Store != nil && !s.isNew {
+			m.Store.Delete(s.ID)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     m.cookieName(),
+			Path:     m.cookiePath(),
+			Domain:   m.Domain,
+			MaxAge:   -1,
+			Secure:   m.Secure,
+			HttpOnly: true,
+			SameSite: m.SameSite,
+		})
+		return nil
+	}
+	if s.isNew && !s.modified {
+		return nil
+	}
+
+	idle, absolute := m.timeouts()
+	s.LastAccess = time.Now()
+	expiresAt := s.LastAccess.Add(idle)
+	if t := s.CreatedAt.Add(absolute); t.Before(expiresAt) {
+		expiresAt = t
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if m.Store != nil {
+		err = m.Store.Save(s.ID, payload, expiresAt)
+		if err != nil {
+			return err
+		}
+		payload = []byte(s.ID)
+	}
+	ctext, err := wl_crypto.AESGCMEncrypt(m.Key, payload, []byte(m.cookieName()))
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(ctext)
+	if len(value) > maxCookieValueSize {
+		return ErrSessionTooLarge
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    value,
+		Path:     m.cookiePath(),
+		Domain:   m.Domain,
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: m.SameSite,
+	})
+	return nil
+}
+
+/*
+CSRF rejects unsafe requests without the csrf token of the session,
+in the X-CSRF-Token header or the csrf_token form field.
+SessionManager.Middleware must be used before it.
+render the token by Session.CSRFToken.
+*/
+func CSRF() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+			s := GetSession(r)
+			token := r.Header.Get(HeaderCSRFToken)
+			if token == "" {
+				token = r.PostFormValue(FormCSRFToken)
+			}
+			if s == nil || !s.checkCSRF(token) {
+				RespondError(w, ErrCSRFInvalid)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package http_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestSessionManager(T *testing.T) {
+	stores := map[string]wshttp.SessionStore{
+		"cookie": nil,
+		"memory": wshttp.NewMemorySessionStore(),
+		"file":   wshttp.NewFileSessionStore(T.TempDir()),
+	}
+	for name, store := range stores {
+		T.Run(name, func(T *testing.T) {
+			testSessionManager(T, store)
+		})
+	}
+}
+
+func testSessionManager(T *testing.T, store wshttp.SessionStore) {
+	sessions := wshttp.NewSessionManager("secret", store)
+	router := wshttp.NewRouter()
+	router.Use(sessions.Middleware(), wshttp.CSRF())
+	router.GET("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, wshttp.GetSession(r).Get("username"))
+	})
+	router.GET("/csrf", func(w http.ResponseWriter, r *http.Request) {
+		token, _ := wshttp.GetSession(r).CSRFToken()
+		io.WriteString(w, token)
+	})
+	router.POST("/login", func(w http.ResponseWriter, r *http.Request) {
+		s := wshttp.GetSession(r)
+		s.RenewID()
+		s.Set("username", r.PostFormValue("username"))
+		io.WriteString(w, s.ID)
+	})
+	router.POST("/logout", func(w http.ResponseWriter, r *http.Request) {
+		wshttp.GetSession(r).Destroy()
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	call := func(method, path string, form url.Values) (int, string) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := client.Do(req)
+		if err != nil {
+			T.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := call(http.MethodGet, "/whoami", nil)
+	if code != http.StatusOK || len(jar.Cookies(mustParseURL(server.URL))) != 0 {
+		T.Errorf("anonymous request should not create a session: %v", jar.Cookies(mustParseURL(server.URL)))
+	}
+
+	code, _ = call(http.MethodPost, "/login", url.Values{"username": {"alice"}})
+	if code != http.StatusForbidden {
+		T.Errorf("login without csrf token: %v", code)
+	}
+
+	_, token := call(http.MethodGet, "/csrf", nil)
+	_, oldID := call(http.MethodPost, "/login", url.Values{"username": {"alice"}, wshttp.FormCSRFToken: {"wrong"}})
+	code, newID := call(http.MethodPost, "/login", url.Values{"username": {"alice"}, wshttp.FormCSRFToken: {token}})
+	if code != http.StatusOK || newID == "" || newID == oldID {
+		T.Errorf("login: %v %q", code, newID)
+	}
+	_, username := call(http.MethodGet, "/whoami", nil)
+	if username != "alice" {
+		T.Errorf("whoami: %q", username)
+	}
+
+	// the csrf token was renewed on login
+	code, _ = call(http.MethodPost, "/logout", url.Values{wshttp.FormCSRFToken: {token}})
+	if code != http.StatusForbidden {
+		T.Errorf("old csrf token accepted: %v", code)
+	}
+	_, token = call(http.MethodGet, "/csrf", nil)
+	cookies := jar.Cookies(mustParseURL(server.URL))
+	code, _ = call(http.MethodPost, "/logout", url.Values{wshttp.FormCSRFToken: {token}})
+	if code != http.StatusOK {
+		T.Errorf("logout: %v", code)
+	}
+	_, username = call(http.MethodGet, "/whoami", nil)
+	if username != "" {
+		T.Errorf("whoami after logout: %q", username)
+	}
+
+	// a copied cookie is rejected after logout, unless sessions are kept in cookies
+	if store != nil {
+		jar.SetCookies(mustParseURL(server.URL), cookies)
+		if _, username = call(http.MethodGet, "/whoami", nil); username != "" {
+			T.Errorf("destroyed session reused: %q", username)
+		}
+	}
+
+	// tampered cookies start a new session
+	jar.SetCookies(mustParseURL(server.URL), []*http.Cookie{{Name: wshttp.DefaultSessionCookieName, Value: "abc"}})
+	if _, username = call(http.MethodGet, "/whoami", nil); username != "" {
+		T.Errorf("tampered cookie accepted: %q", username)
+	}
+}
+
+func TestSessionIdleTimeout(T *testing.T) {
+	sessions := wshttp.NewSessionManager("secret", wshttp.NewMemorySessionStore())
+	sessions.IdleTimeout = 100 * time.Millisecond
+	handler := sessions.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := wshttp.GetSession(r)
+		if r.URL.Query().Get("set") != "" {
+			s.Set("k", "v")
+		}
+		io.WriteString(w, s.Get("k"))
+	}))
+	get := func(path string, cookie *http.Cookie) (*http.Cookie, string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		handler.ServeHTTP(rec, req)
+		cookies := rec.Result().Cookies()
+		if len(cookies) == 0 {
+			return nil, rec.Body.String()
+		}
+		return cookies[0], rec.Body.String()
+	}
+
+	cookie, _ := get("/?set=1", nil)
+	if cookie == nil || !cookie.HttpOnly {
+		T.Fatalf("cookie: %+v", cookie)
+	}
+	// each request extends the idle timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		var body string
+		cookie, body = get("/", cookie)
+		if body != "v" {
+			T.Fatalf("session expired too early: %v", i)
+		}
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, body := get("/", cookie); body != "" {
+		T.Errorf("session not expired: %q", body)
+	}
+}
+
+func TestFileSessionStoreID(T *testing.T) {
+	store := wshttp.NewFileSessionStore(T.TempDir())
+	if err := store.Save("../escape", []byte("x"), time.Now().Add(time.Hour)); err == nil {
+		T.Error("expected error for invalid id")
+	}
+	id := strings.Repeat("a", 64)
+	store.Save(id, []byte("x"), time.Now().Add(-time.Second))
+	store.Cleanup()
+	if _, err := os.Stat(store.Dir + "/" + id); !os.IsNotExist(err) {
+		T.Errorf("expired session not removed: %v", err)
+	}
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestSessionSaveError(T *testing.T) {
+	sessions := wshttp.NewSessionManager("secret", nil)
+	for _, write := range []bool{true, false} {
+		handler := sessions.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wshttp.GetSession(r).Set("k", strings.Repeat("x", 8192))
+			if write {
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, "saved")
+			}
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "saved") ||
+			len(rec.Result().Cookies()) != 0 {
+			T.Errorf("write %v: %v %q", write, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestSessionRenewID(T *testing.T) {
+	sessions := wshttp.NewSessionManager("secret", wshttp.NewMemorySessionStore())
+	handler := sessions.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := wshttp.GetSession(r)
+		switch r.URL.Path {
+		case "/set":
+			s.Set("k", "v")
+		case "/renew":
+			s.RenewID()
+		}
+		io.WriteString(w, s.Get("k")+" "+s.CreatedAt.Format(time.RFC3339Nano))
+	}))
+	get := func(path string, cookie *http.Cookie) (*http.Cookie, string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		handler.ServeHTTP(rec, req)
+		if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+		return cookie, rec.Body.String()
+	}
+
+	oldCookie, created := get("/set", nil)
+	time.Sleep(10 * time.Millisecond)
+	newCookie, renewed := get("/renew", oldCookie)
+	if newCookie.Value == oldCookie.Value || renewed != created {
+		T.Errorf("renew: %q, created %q", renewed, created)
+	}
+	if _, body := get("/", newCookie); body != created {
+		T.Errorf("renewed session: %q, created %q", body, created)
+	}
+	if _, body := get("/", oldCookie); strings.HasPrefix(body, "v ") {
+		T.Errorf("old session still valid: %q", body)
+	}
+}
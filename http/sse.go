@@ -0,0 +1,423 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEEvent is one Server-Sent Event, empty fields are not sent
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+
+	// reconnection time hint for clients, 0 means not set
+	Retry time.Duration
+}
+
+/*
+SSEWriter writes Server-Sent Events to the client.
+
+	sse, err := NewSSEWriter(w, r)
+	if err != nil {
+		RespondError(w, err)
+		return
+	}
+	defer sse.Heartbeat(15 * time.Second)()
+	for line := range lines {
+		if err := sse.Send(&SSEEvent{Data: line}); err != nil {
+			return // client is gone
+		}
+	}
+
+it is safe to call from multiple goroutines
+*/
+type SSEWriter struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	ctx    context.Context
+	lastID string
+
+	mu     sync.Mutex
+	nextID int64
+	err    error
+}
+
+var ErrStreamingUnsupported = RegisterError("STREAMING_UNSUPPORTED", http.StatusInternalServerError, "streaming unsupported", ShowTypeError)
+
+/*
+NewSSEWriter writes the response header, and checks that flushing works.
+w is not written if it cannot flush, so the error can still be responded.
+*/
+func NewSSEWriter(w http.ResponseWriter, r *http.Request) (*SSEWriter, error) {
+	if !canFlush(w) {
+		return nil, ErrStreamingUnsupported
+	}
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// for nginx
+	h.Set("X-Accel-Buffering", "no")
+	// SSE must not time out like normal responses
+	rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, ErrStreamingUnsupported.Wrap(err)
+	}
+	s := &SSEWriter{
+		w:      w,
+		rc:     rc,
+		ctx:    r.Context(),
+		lastID: r.Header.Get("Last-Event-ID"),
+	}
+	if n, err := strconv.ParseInt(s.lastID, 10, 64); err == nil {
+		s.nextID = n + 1
+	}
+	return s, nil
+}
+
+// canFlush checks the innermost writer, wrappers like statusWriter implement Flush anyway
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch v := w.(type) {
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		case http.Flusher, interface{ FlushError() error }:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// LastEventID is sent by a reconnecting client, to resume the stream
+func (s *SSEWriter) LastEventID() string {
+	return s.lastID
+}
+
+// Done is closed when the client disconnects
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *SSEWriter) write(content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return err
+	}
+	if _, err := io.WriteString(s.w, content); err != nil {
+		s.err = err
+		return err
+	}
+	if err := s.rc.Flush(); err != nil {
+		s.err = err
+		return err
+	}
+	return nil
+}
+
+// Send writes e, and returns error once the client is gone
+func (s *SSEWriter) Send(e *SSEEvent) error {
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %v\n", stripNewline(e.ID))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %v\n", stripNewline(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %v\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %v\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// SendData sends data with an increasing numeric id
+func (s *SSEWriter) SendData(event, data string) error {
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	s.mu.Unlock()
+	return s.Send(&SSEEvent{
+		ID:    strconv.FormatInt(id, 10),
+		Event: event,
+		Data:  data,
+	})
+}
+
+func (s *SSEWriter) SendJSON(event string, v any) error {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.SendData(event, string(jsonBytes))
+}
+
+// Retry tells the client how long to wait before reconnecting
+func (s *SSEWriter) Retry(d time.Duration) error {
+	return s.write(fmt.Sprintf("retry: %v\n\n", d.Milliseconds()))
+}
+
+/*
+Heartbeat sends a comment every interval, to keep proxies from closing
+an idle stream and to detect disconnected clients. call the returned
+function to stop.
+*/
+func (s *SSEWriter) Heartbeat(interval time.Duration) func() {
+	stop := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				if s.write(": ping\n\n") != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+/*
+Writer returns an io.Writer sending every line as an event,
+useful to stream the output of commands
+*/
+func (s *SSEWriter) Writer(event string) io.Writer {
+	return &sseLineWriter{s: s, event: event}
+}
+
+type sseLineWriter struct {
+	s     *SSEWriter
+	event string
+	buf   []byte
+}
+
+func (w *sseLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		if err := w.s.SendData(w.event, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func stripNewline(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+/*
+FlushWriter flushes after every Write, for chunked streaming of plain output
+
+	io.Copy(NewFlushWriter(w), stdout)
+*/
+type FlushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func NewFlushWriter(w http.ResponseWriter) *FlushWriter {
+	return &FlushWriter{
+		w:  w,
+		rc: http.NewResponseController(w),
+	}
+}
+
+func (f *FlushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, f.rc.Flush()
+}
+
+/*
+SSEClient subscribes to a Server-Sent Events endpoint,
+and reconnects with Last-Event-ID when the stream breaks.
+*/
+type SSEClient struct {
+	Address   string
+	HeaderMap map[string]string
+
+	// default is a client without timeout, set it for https
+	Client *http.Client
+
+	// wait before reconnecting, updated by the retry field of server
+	// default 3 seconds
+	RetryDelay time.Duration
+
+	// 0 means reconnect forever
+	MaxRetries int
+
+	// id of the last received event, sent when reconnecting
+	LastEventID string
+}
+
+// ErrStopSubscribe can be returned by handler to stop Subscribe without error
+var ErrStopSubscribe = errors.New("stop subscribe")
+
+/*
+Subscribe calls handler for every event until ctx is done, handler returns
+error, the server responds 204, or MaxRetries reconnections failed in a row
+*/
+func (c *SSEClient) Subscribe(ctx context.Context, handler func(e *SSEEvent) error) error {
+	if c.RetryDelay == 0 {
+		c.RetryDelay = 3 * time.Second
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	failures := 0
+	for {
+		received, err := c.subscribeOnce(ctx, client, handler)
+		if errors.Is(err, ErrStopSubscribe) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var se *sseStopError
+		if errors.As(err, &se) {
+			return se.err
+		}
+		if received {
+			failures = 0
+		}
+		failures++
+		if c.MaxRetries > 0 && failures > c.MaxRetries {
+			if err == nil {
+				err = io.EOF
+			}
+			return fmt.Errorf("sse: too many retries: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.RetryDelay):
+		}
+	}
+}
+
+// sseStopError is returned for errors which should not be retried
+type sseStopError struct {
+	err error
+}
+
+func (e *sseStopError) Error() string {
+	if e.err == nil {
+		return "sse: stopped by server"
+	}
+	return e.err.Error()
+}
+
+func (c *SSEClient) subscribeOnce(ctx context.Context, client *http.Client,
+	handler func(e *SSEEvent) error) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Address, nil)
+	if err != nil {
+		return false, &sseStopError{err}
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	request.Header.Set("Cache-Control", "no-cache")
+	for k, v := range c.HeaderMap {
+		request.Header.Set(k, v)
+	}
+	if c.LastEventID != "" {
+		request.Header.Set("Last-Event-ID", c.LastEventID)
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return false, &sseStopError{nil}
+	case resp.StatusCode != http.StatusOK:
+		return false, &sseStopError{fmt.Errorf("sse: unexpected status %v", resp.Status)}
+	}
+
+	received := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var e SSEEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				e.ID = c.LastEventID
+				e.Data = strings.Join(data, "\n")
+				if e.Event == "" {
+					e.Event = "message"
+				}
+				received = true
+				if err := handler(&e); err != nil {
+					if errors.Is(err, ErrStopSubscribe) {
+						return received, err
+					}
+					return received, &sseStopError{err}
+				}
+			}
+			e = SSEEvent{}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			e.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				c.LastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				c.RetryDelay = time.Duration(ms) * time.Millisecond
+				e.Retry = c.RetryDelay
+			}
+		}
+	}
+	return received, scanner.Err()
+}
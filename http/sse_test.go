@@ -0,0 +1,63 @@
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestSSE(T *testing.T) {
+	var lastIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		if len(lastIDs) > 2 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		sse, err := wshttp.NewSSEWriter(w, r)
+		if err != nil {
+			wshttp.RespondError(w, err)
+			return
+		}
+		sse.Retry(10 * time.Millisecond)
+		fmt.Fprint(sse.Writer("output"), "line 1\nline 2\n")
+	}))
+	defer server.Close()
+
+	var received []string
+	client := &wshttp.SSEClient{Address: server.URL}
+	err := client.Subscribe(context.Background(), func(e *wshttp.SSEEvent) error {
+		received = append(received, e.ID+" "+e.Event+" "+e.Data)
+		return nil
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+	expect := []string{"0 output line 1", "1 output line 2", "2 output line 1", "3 output line 2"}
+	if fmt.Sprint(received) != fmt.Sprint(expect) {
+		T.Fatalf("wrong events: %q", received)
+	}
+	if fmt.Sprint(lastIDs) != fmt.Sprint([]string{"", "1", "3"}) {
+		T.Fatalf("wrong Last-Event-ID: %q", lastIDs)
+	}
+}
+
+func TestSSEUnsupported(T *testing.T) {
+	// hides Flush of the recorder, under the statusWriter of Metrics
+	type plainWriter struct{ http.ResponseWriter }
+	recorder := httptest.NewRecorder()
+	w := plainWriter{recorder}
+	handler := wshttp.Metrics(wshttp.NewMetricsRegistry())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := wshttp.NewSSEWriter(w, r)
+		wshttp.RespondError(w, err)
+	}))
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("Content-Type") == "text/event-stream" {
+		T.Fatalf("wrong response: %v %v", recorder.Code, recorder.Header())
+	}
+}
@@ -0,0 +1,737 @@
+package http
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// message types of WebSocket, RFC 6455
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// close codes of WebSocket
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+const (
+	DefaultWebSocketMaxMessageSize = 1 << 20
+	DefaultWebSocketCloseTimeout   = 3 * time.Second
+
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// CloseError is returned by ReadMessage after the close handshake
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %v %v", e.Code, e.Reason)
+}
+
+var errWebSocketClosed = errors.New("websocket: connection closed")
+
+/*
+WebSocketConn is a WebSocket connection of server or client.
+
+one goroutine may call ReadMessage and one may call WriteMessage at the same
+time. ping, pong and close frames are handled inside ReadMessage, so keep
+reading even if you only write, otherwise keepalive can not see the pongs.
+*/
+type WebSocketConn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+
+	// negotiated by Sec-WebSocket-Protocol
+	Subprotocol string
+
+	MaxMessageSize int64
+
+	readMu sync.Mutex
+	// extended after every frame, when keepalive is running
+	readTimeout time.Duration
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	// set by SetWriteDeadline, restored after control frames
+	deadlineMu    sync.Mutex
+	writeDeadline time.Time
+
+	closeOnce     sync.Once
+	closeReceived chan struct{}
+	done          chan struct{}
+	doneOnce      sync.Once
+}
+
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, isServer bool, maxMessageSize int64) *WebSocketConn {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultWebSocketMaxMessageSize
+	}
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &WebSocketConn{
+		conn:           conn,
+		br:             br,
+		isServer:       isServer,
+		MaxMessageSize: maxMessageSize,
+		closeReceived:  make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+func (c *WebSocketConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline applies to data frames, control frames are written with their own timeout
+func (c *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.writeDeadline = t
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Done is closed when the underlying connection is closed
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.done
+}
+
+/*
+ReadMessage returns the next TextMessage or BinaryMessage.
+after the peer closes, it returns *CloseError.
+*/
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	return c.readMessage()
+}
+
+func (c *WebSocketConn) readMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, payload, time.Now().Add(DefaultWebSocketCloseTimeout)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message before last one finished")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %v", opcode))
+		}
+		if int64(len(message)+len(payload)) > c.MaxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid utf8")
+		}
+		return messageType, message, nil
+	}
+}
+
+func (c *WebSocketConn) readFrame() (bool, int, []byte, error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.closeConn()
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	if masked != c.isServer {
+		return false, 0, nil, c.fail(CloseProtocolError, "wrong masking")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			c.closeConn()
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			c.closeConn()
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid length")
+		}
+	}
+	if opcode >= CloseMessage && (length > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > c.MaxMessageSize {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			c.closeConn()
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.closeConn()
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
+
+func (c *WebSocketConn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+	c.closeOnce.Do(func() { close(c.closeReceived) })
+	// echo the close code
+	code := closeErr.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	c.writeClose(code, "")
+	// the server closes the tcp connection first
+	if c.isServer {
+		c.closeConn()
+	}
+	return closeErr
+}
+
+// fail sends a close frame for protocol errors and closes the connection
+func (c *WebSocketConn) fail(code int, reason string) error {
+	c.writeClose(code, reason)
+	c.closeConn()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return errWebSocketClosed
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode))
+	maskBit := byte(0)
+	if !c.isServer {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if c.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	}
+
+	// zero deadline of data frames keeps the one of SetWriteDeadline
+	if !deadline.IsZero() {
+		c.deadlineMu.Lock()
+		userDeadline := c.writeDeadline
+		c.deadlineMu.Unlock()
+		if !userDeadline.IsZero() && userDeadline.Before(deadline) {
+			deadline = userDeadline
+		}
+		c.conn.SetWriteDeadline(deadline)
+		defer func() {
+			c.deadlineMu.Lock()
+			defer c.deadlineMu.Unlock()
+			c.conn.SetWriteDeadline(c.writeDeadline)
+		}()
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *WebSocketConn) writeClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+	return c.writeFrame(CloseMessage, payload, time.Now().Add(DefaultWebSocketCloseTimeout))
+}
+
+// WriteMessage sends one TextMessage or BinaryMessage
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %v", messageType)
+	}
+	if int64(len(data)) > c.MaxMessageSize {
+		return fmt.Errorf("websocket: message too big: %v", len(data))
+	}
+	return c.writeFrame(messageType, data, time.Time{})
+}
+
+func (c *WebSocketConn) WriteJSON(v any) error {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, jsonBytes)
+}
+
+func (c *WebSocketConn) ReadJSON(v any) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *WebSocketConn) Ping(data []byte) error {
+	return c.writeFrame(PingMessage, data, time.Now().Add(DefaultWebSocketCloseTimeout))
+}
+
+/*
+Keepalive sends a ping every interval, and closes the connection if nothing,
+pong included, is received for interval+timeout. it stops with the connection.
+*/
+func (c *WebSocketConn) Keepalive(interval, timeout time.Duration) {
+	c.readTimeout = interval + timeout
+	c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				if c.Ping(nil) != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close does the close handshake with CloseNormalClosure
+func (c *WebSocketConn) Close() error {
+	return c.CloseWithCode(CloseNormalClosure, "")
+}
+
+/*
+CloseWithCode sends a close frame, waits at most DefaultWebSocketCloseTimeout
+for the close frame of peer, and closes the connection
+*/
+func (c *WebSocketConn) CloseWithCode(code int, reason string) error {
+	err := c.writeClose(code, reason)
+	if errors.Is(err, errWebSocketClosed) {
+		return c.closeConn()
+	}
+	if c.readMu.TryLock() {
+		// nobody is reading, read until the close frame of peer
+		c.readTimeout = 0
+		c.conn.SetReadDeadline(time.Now().Add(DefaultWebSocketCloseTimeout))
+		for {
+			if _, _, err := c.readMessage(); err != nil {
+				break
+			}
+		}
+		c.readMu.Unlock()
+	} else {
+		select {
+		case <-c.closeReceived:
+		case <-c.done:
+		case <-time.After(DefaultWebSocketCloseTimeout):
+		}
+	}
+	return c.closeConn()
+}
+
+func (c *WebSocketConn) closeConn() error {
+	var err error
+	c.doneOnce.Do(func() {
+		err = c.conn.Close()
+		close(c.done)
+	})
+	return err
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+WebSocketUpgrader upgrades http requests to WebSocket
+
+	upgrader := &WebSocketUpgrader{PingInterval: 30 * time.Second}
+	router.GET("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			return // already responded
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			...
+		}
+	})
+*/
+type WebSocketUpgrader struct {
+	// default allows same host only
+	CheckOrigin func(r *http.Request) bool
+
+	// the first one also requested by client is chosen
+	Subprotocols []string
+
+	// default DefaultWebSocketMaxMessageSize
+	MaxMessageSize int64
+
+	// keepalive is disabled if 0
+	PingInterval time.Duration
+	// default PingInterval
+	PongTimeout time.Duration
+}
+
+var ErrWebSocketHandshake = RegisterError("WEBSOCKET_HANDSHAKE", http.StatusBadRequest, "websocket handshake failed", ShowTypeError)
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade responds the error through RespondError if handshake fails
+func (u *WebSocketUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*WebSocketConn, error) {
+	fail := func(err *APIError) (*WebSocketConn, error) {
+		RespondError(w, err)
+		return nil, err
+	}
+	if r.Method != http.MethodGet {
+		return fail(ErrMethodNotAllowed)
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return fail(ErrWebSocketHandshake.WithMessage("not a websocket request"))
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(ErrWebSocketHandshake.WithMessage("unsupported websocket version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(ErrWebSocketHandshake.WithMessage("invalid Sec-WebSocket-Key"))
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return fail(ErrForbidden.WithMessage("origin not allowed"))
+	}
+
+	subprotocol := ""
+	for _, v := range u.Subprotocols {
+		if headerContainsToken(r.Header, "Sec-WebSocket-Protocol", v) {
+			subprotocol = v
+			break
+		}
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fail(ErrStreamingUnsupported.Wrap(err))
+	}
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	b.WriteString("Upgrade: websocket\r\n")
+	b.WriteString("Connection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + computeAcceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	b.WriteString("\r\n")
+	// clear deadlines set by http.Server
+	netConn.SetDeadline(time.Time{})
+	if _, err := netConn.Write([]byte(b.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	conn := newWebSocketConn(netConn, brw.Reader, true, u.MaxMessageSize)
+	conn.Subprotocol = subprotocol
+	if u.PingInterval > 0 {
+		timeout := u.PongTimeout
+		if timeout == 0 {
+			timeout = u.PingInterval
+		}
+		conn.Keepalive(u.PingInterval, timeout)
+	}
+	return conn, nil
+}
+
+/*
+WebSocketDialer connects to WebSocket servers, ws:// or wss://.
+for wss, the tls settings of HttpsClient are used if set: CA file and mutual TLS.
+*/
+type WebSocketDialer struct {
+	HttpsClient *HttpsClient
+	SkipVerify  bool
+
+	HeaderMap    map[string]string
+	Subprotocols []string
+
+	// default 10 seconds
+	HandshakeTimeout time.Duration
+
+	// default DefaultWebSocketMaxMessageSize
+	MaxMessageSize int64
+
+	// keepalive is disabled if 0
+	PingInterval time.Duration
+	// default PingInterval
+	PongTimeout time.Duration
+}
+
+// Dial returns the handshake response too, useful when the handshake fails
+func (d *WebSocketDialer) Dial(address string) (*WebSocketConn, *http.Response, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	useTLS := false
+	switch u.Scheme {
+	case "ws", "http":
+	case "wss", "https":
+		useTLS = true
+	default:
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %v", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if useTLS {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	timeout := d.HandshakeTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	netConn, err := (&net.Dialer{Deadline: deadline}).Dial("tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	netConn.SetDeadline(deadline)
+
+	if useTLS {
+		tlsConn, err := d.tlsClient(netConn, u.Hostname())
+		if err != nil {
+			netConn.Close()
+			return nil, nil, err
+		}
+		netConn = tlsConn
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	requestURL := *u
+	if useTLS {
+		requestURL.Scheme = "https"
+	} else {
+		requestURL.Scheme = "http"
+	}
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &requestURL,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for k, v := range d.HeaderMap {
+		request.Header.Set(k, v)
+	}
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if len(d.Subprotocols) > 0 {
+		request.Header.Set("Sec-WebSocket-Protocol", strings.Join(d.Subprotocols, ", "))
+	}
+	if err := request.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, request)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerContainsToken(resp.Header, "Upgrade", "websocket") ||
+		!headerContainsToken(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != computeAcceptKey(key) {
+		netConn.Close()
+		return nil, resp, fmt.Errorf("websocket: bad handshake: %v", resp.Status)
+	}
+	netConn.SetDeadline(time.Time{})
+
+	conn := newWebSocketConn(netConn, br, false, d.MaxMessageSize)
+	conn.Subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	if d.PingInterval > 0 {
+		timeout := d.PongTimeout
+		if timeout == 0 {
+			timeout = d.PingInterval
+		}
+		conn.Keepalive(d.PingInterval, timeout)
+	}
+	return conn, resp, nil
+}
+
+func (d *WebSocketDialer) tlsClient(conn net.Conn, serverName string) (*tls.Conn, error) {
+	var config *tls.Config
+	if d.HttpsClient != nil {
+		c, err := d.HttpsClient.TLSConfig(d.SkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		config = c.Clone()
+	} else {
+		config = &tls.Config{InsecureSkipVerify: d.SkipVerify}
+	}
+	if config.ServerName == "" {
+		config.ServerName = serverName
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
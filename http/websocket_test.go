@@ -0,0 +1,111 @@
+package http_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	wshttp "github.com/wsva/lib_go/http"
+)
+
+func TestWebSocket(T *testing.T) {
+	upgrader := &wshttp.WebSocketUpgrader{
+		Subprotocols:   []string{"echo"},
+		MaxMessageSize: 16,
+		PingInterval:   20 * time.Millisecond,
+		PongTimeout:    200 * time.Millisecond,
+	}
+	closed := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			conn.WriteMessage(messageType, data)
+		}
+	}))
+	defer server.Close()
+
+	dialer := &wshttp.WebSocketDialer{Subprotocols: []string{"chat", "echo"}}
+	address := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := dialer.Dial(address)
+	if err != nil {
+		T.Fatal(err)
+	}
+	if conn.Subprotocol != "echo" {
+		T.Fatalf("wrong subprotocol: %v", conn.Subprotocol)
+	}
+	if err := conn.WriteMessage(wshttp.TextMessage, []byte("hello")); err != nil {
+		T.Fatal(err)
+	}
+	// keepalive pings of server are answered while reading
+	time.Sleep(50 * time.Millisecond)
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != wshttp.TextMessage || string(data) != "hello" {
+		T.Fatalf("wrong echo: %v %q %v", messageType, data, err)
+	}
+	if err := conn.Close(); err != nil {
+		T.Fatal(err)
+	}
+	var ce *wshttp.CloseError
+	if err := <-closed; !errors.As(err, &ce) || ce.Code != wshttp.CloseNormalClosure {
+		T.Fatalf("server got %v", err)
+	}
+
+	// write deadline is kept after control frames
+	conn, _, err = dialer.Dial(address)
+	if err != nil {
+		T.Fatal(err)
+	}
+	conn.SetWriteDeadline(time.Now().Add(-time.Second))
+	if err := conn.WriteMessage(wshttp.TextMessage, []byte("late")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		T.Fatalf("deadline ignored: %v", err)
+	}
+	conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	if err := conn.Ping(nil); err != nil {
+		T.Fatal(err)
+	}
+	if err := conn.WriteMessage(wshttp.TextMessage, []byte("hello")); err != nil {
+		T.Fatal(err)
+	}
+	conn.SetWriteDeadline(time.Now().Add(-time.Second))
+	conn.Ping(nil)
+	if err := conn.WriteMessage(wshttp.TextMessage, []byte("late")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		T.Fatalf("deadline reset by ping: %v", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+	conn.Close()
+	<-closed
+
+	// message size limit
+	conn, _, err = dialer.Dial(address)
+	if err != nil {
+		T.Fatal(err)
+	}
+	conn.WriteMessage(wshttp.BinaryMessage, make([]byte, 17))
+	if _, _, err := conn.ReadMessage(); !errors.As(err, &ce) || ce.Code != wshttp.CloseMessageTooBig {
+		T.Fatalf("client got %v", err)
+	}
+	conn.Close()
+
+	// plain http request is rejected
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		T.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		T.Fatalf("wrong status: %v", resp.StatusCode)
+	}
+}
@@ -56,6 +56,12 @@ func (l *Location) Parse() error {
 			return err
 		}
 		l.pointer = &location
+	case "SFTP":
+		location, err := parseLocationSFTP(l.LocationInfo)
+		if err != nil {
+			return err
+		}
+		l.pointer = location
 	case "FTP":
 		var location LocationFTP
 		err := json.Unmarshal(l.LocationInfo, &location)
@@ -188,6 +194,9 @@ func (l *LocationFTP) Upload(src string) error {
 
 type LocationWebHttp struct {
 	URL string `json:"URL"`
+
+	// cache downloads on disk, see wl_http.HttpCache
+	CacheDir string `json:"CacheDir"`
 }
 
 // dest is fullpath filename of destination
@@ -196,6 +205,9 @@ func (l *LocationWebHttp) Download(dest string) error {
 		Address: l.URL,
 		Method:  http.MethodGet,
 	}
+	if l.CacheDir != "" {
+		client.Cache = wl_http.NewDiskCache(l.CacheDir)
+	}
 	resp, err := client.DoRequest()
 	if err != nil {
 		return err
@@ -225,6 +237,9 @@ type LocationWebHttps struct {
 	MutualTLS     bool   `json:"MutualTLS"`
 	ClientCrtFile string `json:"ClientCrtFile"`
 	ClientKeyFile string `json:"ClientKeyFile"`
+
+	// cache downloads on disk, see wl_http.HttpCache
+	CacheDir string `json:"CacheDir"`
 }
 
 // dest is fullpath filename of destination
@@ -237,6 +252,9 @@ func (l *LocationWebHttps) Download(dest string) error {
 		ClientCrtFile: l.ClientCrtFile,
 		ClientKeyFile: l.ClientKeyFile,
 	}
+	if l.CacheDir != "" {
+		client.Cache = wl_http.NewDiskCache(l.CacheDir)
+	}
 	resp, err := client.DoRequest(false)
 	if err != nil {
 		return err
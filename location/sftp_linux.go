@@ -0,0 +1,50 @@
+//go:build linux
+
+package location
+
+import (
+	"encoding/json"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+)
+
+/*
+LocationSFTP is a file on a SSH host, like
+
+	{"IP": "10.0.0.1", "Port": "22", "Username": "user", "KeyFile": "/home/user/.ssh/id_ed25519",
+	 "KnownHostsFile": "/home/user/.ssh/known_hosts", "Path": "/data/file"}
+
+all fields of ssh.SSH can be used, including AuthMethods and JumpHosts.
+*/
+type LocationSFTP struct {
+	wl_ssh.SSH
+	Path string `json:"Path"`
+}
+
+func parseLocationSFTP(info json.RawMessage) (LocationInterface, error) {
+	var location LocationSFTP
+	err := json.Unmarshal(info, &location)
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// dest is fullpath filename of destination
+func (l *LocationSFTP) Download(dest string) error {
+	defer l.closeSSH()
+	return l.SSH.Download(l.Path, dest, nil)
+}
+
+// src is fullpath filename of source
+func (l *LocationSFTP) Upload(src string) error {
+	defer l.closeSSH()
+	return l.SSH.Upload(src, l.Path, nil)
+}
+
+func (l *LocationSFTP) closeSSH() {
+	if l.Client != nil {
+		l.Close()
+		l.Client = nil
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package location
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+func parseLocationSFTP(info json.RawMessage) (LocationInterface, error) {
+	return nil, errors.New("location type SFTP is only supported on linux")
+}
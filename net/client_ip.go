@@ -0,0 +1,195 @@
+package net
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+IPResolver finds the client ip of a request.
+
+forwarding headers are only trusted when the peer is a trusted proxy.
+X-Forwarded-For and Forwarded (RFC 7239) are walked right-to-left,
+skipping trusted proxies, and the first untrusted hop is the client.
+*/
+type IPResolver struct {
+	mu             sync.RWMutex
+	trustedProxies []*net.IPNet
+}
+
+// NewIPResolver parses trustedProxies with ParseCIDRs, single ips are allowed
+func NewIPResolver(trustedProxies []string) (*IPResolver, error) {
+	r := &IPResolver{}
+	err := r.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *IPResolver) SetTrustedProxies(trustedProxies []string) error {
+	cidrList := make([]string, len(trustedProxies))
+	for i, v := range trustedProxies {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		cidrList[i] = v
+	}
+	cidrs, err := ParseCIDRs(cidrList)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.trustedProxies = cidrs
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *IPResolver) IsTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.trustedProxies {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns nil if RemoteAddr is not an ip
+func (r *IPResolver) Resolve(req *http.Request) net.IP {
+	peer := parseNodeIP(req.RemoteAddr)
+	if !r.IsTrusted(peer) {
+		return peer
+	}
+
+	var hops []net.IP
+	var found bool
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		hops, found = parseForwarded(values), true
+	} else if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops, found = parseXForwardedFor(values), true
+	}
+	if found {
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			// the proxy did not tell a valid ip, stop at the proxy
+			if hops[i] == nil {
+				return client
+			}
+			client = hops[i]
+			if !r.IsTrusted(client) {
+				return client
+			}
+		}
+		return client
+	}
+
+	if ip := parseNodeIP(req.Header.Get("X-Real-Ip")); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+/*
+parseNodeIP accepts ip, ip:port, [ipv6] and [ipv6]:port,
+returns nil for anything else, like "unknown" or obfuscated identifiers
+*/
+func parseNodeIP(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+	if strings.HasPrefix(node, "[") && strings.HasSuffix(node, "]") {
+		return net.ParseIP(node[1 : len(node)-1])
+	}
+	return nil
+}
+
+func parseXForwardedFor(values []string) []net.IP {
+	var result []net.IP
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			if strings.TrimSpace(hop) == "" {
+				continue
+			}
+			result = append(result, parseNodeIP(hop))
+		}
+	}
+	return result
+}
+
+/*
+parseForwarded parses RFC 7239 header values like
+
+	for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+
+elements without "for" are kept as nil, so they are never trusted
+*/
+func parseForwarded(values []string) []net.IP {
+	var result []net.IP
+	for _, v := range values {
+		for _, element := range splitQuoted(v, ',') {
+			if strings.TrimSpace(element) == "" {
+				continue
+			}
+			var ip net.IP
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, ok := strings.Cut(pair, "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "for") {
+					continue
+				}
+				value = strings.TrimSpace(value)
+				if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+					value = strings.ReplaceAll(value[1:len(value)-1], `\`, "")
+				}
+				ip = parseNodeIP(value)
+			}
+			result = append(result, ip)
+		}
+	}
+	return result
+}
+
+// splitQuoted splits s by sep, except inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var result []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, s[start:])
+}
+
+/*
+DefaultIPResolver is used by GetIPFromRequest.
+it trusts no proxy, so forwarding headers are ignored until SetTrustedProxies.
+*/
+var DefaultIPResolver = &IPResolver{}
+
+// SetTrustedProxies sets trusted proxies of DefaultIPResolver
+func SetTrustedProxies(trustedProxies []string) error {
+	return DefaultIPResolver.SetTrustedProxies(trustedProxies)
+}
@@ -0,0 +1,47 @@
+package net_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wsnet "github.com/wsva/lib_go/net"
+)
+
+func TestIPResolver(T *testing.T) {
+	resolver, err := wsnet.NewIPResolver([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		T.Fatal(err)
+	}
+	cases := []struct {
+		remote string
+		header map[string]string
+		expect string
+	}{
+		// untrusted peer cannot spoof
+		{"1.2.3.4:5678", map[string]string{"X-Forwarded-For": "9.9.9.9"}, "1.2.3.4"},
+		{"1.2.3.4:5678", map[string]string{"X-Real-Ip": "9.9.9.9"}, "1.2.3.4"},
+		// right-to-left, skipping trusted proxies
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "9.9.9.9, 5.5.5.5, 10.0.0.2"}, "5.5.5.5"},
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "5.5.5.5, garbage"}, "10.0.0.1"},
+		{"10.0.0.1:80", map[string]string{"X-Real-Ip": "5.5.5.5"}, "5.5.5.5"},
+		// ipv6 peer
+		{"[2001:db8::2]:443", map[string]string{"X-Forwarded-For": "5.5.5.5"}, "2001:db8::2"},
+		{"[2001:db8::1]:443", map[string]string{"X-Forwarded-For": "5.5.5.5"}, "5.5.5.5"},
+		// RFC 7239
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.9`}, "2001:db8:cafe::17"},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for=192.0.2.60;by=10.0.0.1`, "X-Forwarded-For": "9.9.9.9"}, "192.0.2.60"},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for=unknown`}, "10.0.0.1"},
+	}
+	for i, v := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = v.remote
+		for k, hv := range v.header {
+			r.Header.Set(k, hv)
+		}
+		if got := resolver.Resolve(r).String(); got != v.expect {
+			T.Errorf("case %v: expect %v, got %v", i, v.expect, got)
+		}
+	}
+}
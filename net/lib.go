@@ -29,35 +29,14 @@ func GetHostIPv2(dest string) net.IP {
 	return conn.LocalAddr().(*net.UDPAddr).IP
 }
 
-// use IP.String() to get a string
-func GetIPFromRequest(r *http.Request) net.IP {
-	var remoteIP net.IP
-	// the default is the originating ip. but we try to find better options because this is almost
-	// never the right IP
-	if parts := strings.Split(r.RemoteAddr, ":"); len(parts) == 2 {
-		remoteIP = net.ParseIP(parts[0])
-	}
-	// If we have a forwarded-for header, take the address from there
-	if xff := strings.Trim(r.Header.Get("X-Forwarded-For"), ","); len(xff) > 0 {
-		addrs := strings.Split(xff, ",")
-		lastFwd := addrs[len(addrs)-1]
-		if ip := net.ParseIP(lastFwd); ip != nil {
-			remoteIP = ip
-		}
-
-	} else if xri := r.Header.Get("X-Real-Ip"); len(xri) > 0 {
-		// parse X-Real-Ip header
-		if ip := net.ParseIP(xri); ip != nil {
-			remoteIP = ip
-		}
-	} else if xri := r.Header.Get("X-Real-IP"); len(xri) > 0 {
-		// parse X-Real-IP header
-		if ip := net.ParseIP(xri); ip != nil {
-			remoteIP = ip
-		}
-	}
+/*
+GetIPFromRequest resolves the client ip with DefaultIPResolver,
+forwarding headers are trusted only from proxies set by SetTrustedProxies
 
-	return remoteIP
+use IP.String() to get a string
+*/
+func GetIPFromRequest(r *http.Request) net.IP {
+	return DefaultIPResolver.Resolve(r)
 }
 
 /*
@@ -102,8 +81,16 @@ func GetQueryValueListFromRequest(r *http.Request, key string) []string {
 	return query[key]
 }
 
+/*
+GetOneQueryValueFromRequest returns empty if key is missing
+
+Deprecated: use QueryString of github.com/wsva/lib_go/http
+*/
 func GetOneQueryValueFromRequest(r *http.Request, key string) string {
 	query := r.URL.Query()
+	if len(query[key]) == 0 {
+		return ""
+	}
 	return query[key][0]
 }
 
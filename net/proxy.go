@@ -1,6 +1,7 @@
 package net
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -35,8 +36,13 @@ func GetRequestString(req *http.Request) string {
 
 	result += "\r\n"
 
-	body, _ := io.ReadAll(req.Body)
-	result += string(body)
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		req.Body.Close()
+		// restore body, so req can still be sent
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		result += string(body)
+	}
 
 	return result
 }
@@ -4,12 +4,17 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"net"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	expect "github.com/google/goexpect"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -69,36 +74,106 @@ func NewSSHSuTo(username, password string) *SSHSuTo {
 }
 
 type SSH struct {
-	IP        string      `json:"IP"`
-	Port      string      `json:"Port"`
-	Username  string      `json:"Username"`
-	Password  string      `json:"Password"`
+	IP       string `json:"IP"`
+	Port     string `json:"Port"`
+	Username string `json:"Username"`
+	Password string `json:"Password"`
+
+	//private key in OpenSSH or PEM format, see LoadPrivateKey
+	KeyFile       string `json:"KeyFile"`
+	KeyPassphrase string `json:"KeyPassphrase"`
+
+	//tried in order, like AuthPublicKey, AuthAgent, AuthPassword.
+	//default publickey if KeyFile is set, then password and keyboard-interactive.
+	//AuthAgent uses SSH_AUTH_SOCK, skipped if unset or the agent is unavailable.
+	AuthMethods []string `json:"AuthMethods"`
+
+	//default answers Password to every question
+	KeyboardInteractive ssh.KeyboardInteractiveChallenge `json:"-"`
+
+	//OpenSSH known_hosts file, "~/" is expanded
+	KnownHostsFile string `json:"KnownHostsFile"`
+	//pinned keys, like "SHA256:..." from ssh-keygen -l
+	HostKeyFingerprints []string `json:"HostKeyFingerprints"`
+	//HostKeyStrict, HostKeyTOFU or HostKeyInsecure, default strict.
+	//DefaultKnownHostsFile is used if neither KnownHostsFile nor HostKeyFingerprints is set.
+	//breaking change: the default was insecure, now hosts not in known_hosts are rejected,
+	//set HostKeyInsecure explicitly for the old behaviour, or HostKeyTOFU to learn new hosts.
+	HostKeyPolicy string `json:"HostKeyPolicy"`
+
+	//dialed in order before this host, like ProxyJump of OpenSSH
+	JumpHosts []*SSH `json:"JumpHosts"`
+
 	SSHConfig *SSHConfig  `json:"-"`
 	Client    *ssh.Client `json:"-"`
+
+	jumpClients []*ssh.Client
+	sftpClient  *sftp.Client
 }
 
-func (s *SSH) Dial() error {
+// the returned io.Closer must be closed after dial, if not nil
+func (s *SSH) clientConfig() (*ssh.ClientConfig, io.Closer, error) {
 	if s.SSHConfig == nil {
 		s.SSHConfig = DefaultSSHConfig()
 	}
-	config := &ssh.ClientConfig{
-		User: s.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(s.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         s.SSHConfig.TimeoutSSH,
+	auth, closer, err := s.authMethods()
+	if err != nil {
+		return nil, nil, err
 	}
-	client, err := ssh.Dial("tcp", s.IP+":"+s.Port, config)
+	hostKeyCallback, err := s.hostKeyCallback()
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, nil, err
+	}
+	return &ssh.ClientConfig{
+		User:              s.Username,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: s.hostKeyAlgorithms(s.addr()),
+		Timeout:           s.SSHConfig.TimeoutSSH,
+	}, closer, nil
+}
+
+func (s *SSH) addr() string {
+	return net.JoinHostPort(s.IP, s.Port)
+}
+
+func (s *SSH) Dial() error {
+	client, jumps, err := s.dial(context.Background())
 	if err != nil {
 		return err
 	}
 	s.Client = client
+	s.jumpClients = jumps
 	return nil
 }
 
+/*
+Check opens a new connection and closes it, used as a health check.
+s.Client is not touched.
+*/
+func (s *SSH) Check(ctx context.Context) error {
+	client, jumps, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.Close()
+	closeClients(jumps)
+	return err
+}
+
+// Close closes the client, and the jump hosts
 func (s *SSH) Close() error {
-	return s.Client.Close()
+	if s.sftpClient != nil {
+		s.sftpClient.Close()
+		s.sftpClient = nil
+	}
+	err := s.Client.Close()
+	closeClients(s.jumpClients)
+	s.jumpClients = nil
+	return err
 }
 
 /*
@@ -142,8 +217,13 @@ func (s *SSH) ExecV02(cmdList []string) (string, error) {
 	}
 	defer session.Close()
 
+	//input is read by another goroutine after Shell, so it is written before
 	input := bytes.NewBuffer(nil)
-	output := bytes.NewBuffer(nil)
+	for _, v := range cmdList {
+		input.WriteString(s.appendCharReturn(v))
+	}
+	input.WriteString("exit\n")
+	output := &lockedBuffer{}
 
 	session.Stdin = input
 	session.Stdout = output
@@ -153,11 +233,6 @@ func (s *SSH) ExecV02(cmdList []string) (string, error) {
 		return "", err
 	}
 
-	for _, v := range cmdList {
-		input.WriteString(s.appendCharReturn(v))
-	}
-	input.WriteString("exit\n")
-
 	err = session.Wait()
 	if err != nil {
 		return "", err
@@ -172,6 +247,7 @@ func (s *SSH) ExecV02(cmdList []string) (string, error) {
 1，支持给每个命令指定超时时间
 2，仅命令执行的输出，包括其他输出的全部输出
 3，支持设置中途报错是否终止执行
+4，stdout和stderr无法区分，需要区分或者需要退出码时用Exec
 */
 func (s *SSH) ExecV03(cmdList []SSHCmd, stop bool) (string, string, error) {
 	if s.Client == nil {
@@ -229,6 +305,7 @@ su之后再执行多个命令
 1，支持给每个命令指定超时时间
 2，仅命令执行的输出，包括其他输出的全部输出
 3，支持设置中途报错是否终止执行
+4，stdout和stderr无法区分，需要区分或者需要退出码时用Exec
 */
 func (s *SSH) ExecV04(su *SSHSuTo, cmdList []SSHCmd, stop bool) (string, string, error) {
 	if s.Client == nil {
@@ -331,3 +408,21 @@ func (s *SSH) deleteLastLine(content string) string {
 	}
 	return result
 }
+
+// lockedBuffer is written by the stdout and stderr goroutines of a session
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
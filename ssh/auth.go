@@ -0,0 +1,146 @@
+//go:build linux
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	wl_crypto "github.com/wsva/lib_go/crypto"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// names of SSH.AuthMethods
+const (
+	AuthPassword            = "password"
+	AuthPublicKey           = "publickey"
+	AuthAgent               = "agent"
+	AuthKeyboardInteractive = "keyboard-interactive"
+)
+
+/*
+authMethods returns the auth methods in the order of s.AuthMethods.
+
+the server allows only one try of each method name,
+so AuthPublicKey and AuthAgent are merged into one publickey method,
+at the position of the first one, keys in order.
+
+the returned io.Closer closes the agent connection, after dial.
+*/
+func (s *SSH) authMethods() ([]ssh.AuthMethod, io.Closer, error) {
+	names := s.AuthMethods
+	if len(names) == 0 {
+		if s.KeyFile != "" {
+			names = append(names, AuthPublicKey)
+		}
+		names = append(names, AuthPassword, AuthKeyboardInteractive)
+	}
+
+	var result []ssh.AuthMethod
+	var signers []ssh.Signer
+	var agentConn net.Conn
+	publicKeyAdded := false
+	for _, v := range names {
+		switch v {
+		case AuthPassword:
+			result = append(result, ssh.Password(s.Password))
+		case AuthKeyboardInteractive:
+			challenge := s.KeyboardInteractive
+			if challenge == nil {
+				challenge = s.answerPassword
+			}
+			result = append(result, ssh.KeyboardInteractive(challenge))
+		case AuthPublicKey:
+			if s.KeyFile == "" {
+				continue
+			}
+			signer, err := LoadPrivateKey(s.KeyFile, s.KeyPassphrase)
+			if err != nil {
+				closeConn(agentConn)
+				return nil, nil, err
+			}
+			signers = append(signers, signer)
+		case AuthAgent:
+			if agentConn != nil {
+				continue
+			}
+			socket := os.Getenv("SSH_AUTH_SOCK")
+			if socket == "" {
+				continue
+			}
+			// an unavailable agent is skipped like an unset one, other methods are still tried
+			conn, err := net.Dial("unix", socket)
+			if err != nil {
+				continue
+			}
+			agentSigners, err := agent.NewClient(conn).Signers()
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			agentConn = conn
+			signers = append(signers, agentSigners...)
+		default:
+			closeConn(agentConn)
+			return nil, nil, fmt.Errorf("unknown auth method: %v", v)
+		}
+		if (v == AuthPublicKey || v == AuthAgent) && !publicKeyAdded {
+			publicKeyAdded = true
+			// signers is read at auth time, so later keys are included
+			result = append(result, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return signers, nil
+			}))
+		}
+	}
+	if agentConn == nil {
+		return result, nil, nil
+	}
+	return result, agentConn, nil
+}
+
+func closeConn(conn net.Conn) {
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// answerPassword answers s.Password to every question
+func (s *SSH) answerPassword(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i := range answers {
+		answers[i] = s.Password
+	}
+	return answers, nil
+}
+
+/*
+LoadPrivateKey loads a private key in OpenSSH or PEM format,
+passphrase is only used for encrypted keys.
+*/
+func LoadPrivateKey(filename, passphrase string) (ssh.Signer, error) {
+	contentBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(contentBytes)
+	if err == nil {
+		return signer, nil
+	}
+	var pme *ssh.PassphraseMissingError
+	if errors.As(err, &pme) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%v is encrypted, passphrase is required", filename)
+		}
+		return ssh.ParsePrivateKeyWithPassphrase(contentBytes, []byte(passphrase))
+	}
+	// PEM files with extra blocks, like EC PARAMETERS
+	key, perr := wl_crypto.ParsePrivateKeyPEM(contentBytes)
+	if perr != nil {
+		return nil, fmt.Errorf("parse private key %v error: %w", filename, err)
+	}
+	return ssh.NewSignerFromKey(key)
+}
@@ -0,0 +1,136 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	wl_crypto "github.com/wsva/lib_go/crypto"
+	wl_ssh "github.com/wsva/lib_go/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestAuthMethods(T *testing.T) {
+	fileKey, fileSigner := newTestSigner(T)
+	agentKey, agentSigner := newTestSigner(T)
+	dir := T.TempDir()
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(fileKey, "", []byte("secret"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	encryptedKeyFile := filepath.Join(dir, "id_encrypted")
+	os.WriteFile(encryptedKeyFile, pem.EncodeToMemory(block), 0600)
+	// x/crypto does not parse a leading EC PARAMETERS block, the crypto PEM loader does
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		T.Fatal(err)
+	}
+	ecSigner, _ := ssh.NewSignerFromKey(ecKey)
+	pemBytes, err := wl_crypto.MarshalPrivateKeyToPEM(ecKey)
+	if err != nil {
+		T.Fatal(err)
+	}
+	params := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}})
+	pemKeyFile := filepath.Join(dir, "id_pem")
+	os.WriteFile(pemKeyFile, append(params, pemBytes...), 0600)
+
+	keyring := agent.NewKeyring()
+	keyring.Add(agent.AddedKey{PrivateKey: agentKey})
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	T.Setenv("SSH_AUTH_SOCK", socket)
+
+	server := newTestServer(T, &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, v := range []ssh.Signer{fileSigner, ecSigner, agentSigner} {
+				if bytes.Equal(key.Marshal(), v.PublicKey().Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, errors.New("unknown key")
+		},
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: ", "OTP: "}, []bool{false, true})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 2 || answers[0] != "password" || answers[1] != "123456" {
+				return nil, errors.New("wrong answers")
+			}
+			return nil, nil
+		},
+	})
+
+	otp := func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		return []string{"password", "123456"}, nil
+	}
+	cases := []struct {
+		name string
+		s    wl_ssh.SSH
+		ok   bool
+	}{
+		{"encrypted key", wl_ssh.SSH{KeyFile: encryptedKeyFile, KeyPassphrase: "secret"}, true},
+		{"missing passphrase", wl_ssh.SSH{KeyFile: encryptedKeyFile}, false},
+		{"pem key", wl_ssh.SSH{KeyFile: pemKeyFile, AuthMethods: []string{wl_ssh.AuthPublicKey}}, true},
+		{"agent", wl_ssh.SSH{AuthMethods: []string{wl_ssh.AuthAgent}}, true},
+		{"keyboard-interactive", wl_ssh.SSH{KeyboardInteractive: otp}, true},
+		{"default answers", wl_ssh.SSH{Password: "password"}, false},
+		{"priority", wl_ssh.SSH{
+			Password:    "wrong",
+			KeyFile:     pemKeyFile,
+			AuthMethods: []string{wl_ssh.AuthPassword, wl_ssh.AuthAgent, wl_ssh.AuthPublicKey},
+		}, true},
+		{"unknown method", wl_ssh.SSH{AuthMethods: []string{"hostbased"}}, false},
+	}
+	for _, c := range cases {
+		c.s.IP, c.s.Port, c.s.Username = server.Host, server.Port, "username"
+		c.s.HostKeyFingerprints = []string{fingerprint(server)}
+		err := c.s.Dial()
+		if (err == nil) != c.ok {
+			T.Errorf("%v: %v", c.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		output, err := c.s.ExecV01("whoami")
+		if err != nil || output != "whoami" {
+			T.Errorf("%v: exec %q %v", c.name, output, err)
+		}
+		c.s.Close()
+	}
+
+	T.Setenv("SSH_AUTH_SOCK", filepath.Join(dir, "missing.sock"))
+	s := wl_ssh.SSH{IP: server.Host, Port: server.Port, Username: "username",
+		KeyFile: pemKeyFile, AuthMethods: []string{wl_ssh.AuthAgent, wl_ssh.AuthPublicKey},
+		HostKeyFingerprints: []string{fingerprint(server)}}
+	if err := s.Dial(); err != nil {
+		T.Errorf("unavailable agent: %v", err)
+	} else {
+		s.Close()
+	}
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CmdResult is the result of one command run by Exec
+type CmdResult struct {
+	Cmd string `json:"Cmd"`
+	//empty if not captured, see SSHCmd
+	Stdout string `json:"Stdout"`
+	Stderr string `json:"Stderr"`
+	//-1 if the command did not exit, 128+n if killed by signal n
+	ExitCode int `json:"ExitCode"`
+	//signal name without "SIG", like "KILL", empty if not killed by signal
+	Signal   string        `json:"Signal"`
+	Duration time.Duration `json:"Duration"`
+}
+
+type ExecOptions struct {
+	/*
+		set by env requests, which most servers only accept as AcceptEnv in sshd_config,
+		rejected ones are exported in the command instead.
+		names must match [A-Za-z_][A-Za-z0-9_]*, otherwise Exec fails.
+	*/
+	Env map[string]string
+	//output is streamed to them while running, can be nil
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+}
+
+/*
+Exec runs cmd in a new session, with stdout and stderr captured apart.
+cmd.Timeout is the timeout of the command, default SSHTimeout.
+cmd.StdOut and cmd.StdErr choose what is captured in the result,
+with cmd.Combine, stderr is captured in Stdout of the result.
+the session is killed when ctx is done. opts can be nil.
+
+a non-zero exit code is not an error, it is in the result.
+the result is not nil even if there is an error.
+*/
+func (s *SSH) Exec(ctx context.Context, cmd SSHCmd, opts *ExecOptions) (*CmdResult, error) {
+	result := &CmdResult{Cmd: cmd.Cmd, ExitCode: -1}
+	if opts == nil {
+		opts = &ExecOptions{}
+	}
+	for k := range opts.Env {
+		if !envNameRegexp.MatchString(k) {
+			return result, fmt.Errorf("invalid env name: %q", k)
+		}
+	}
+	if s.Client == nil {
+		err := s.Dial()
+		if err != nil {
+			return result, err
+		}
+	}
+	if cmd.Timeout == 0 {
+		cmd.Timeout = SSHTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmd.Timeout)
+	defer cancel()
+
+	session, err := s.Client.NewSession()
+	if err != nil {
+		return result, fmt.Errorf("create session error: %w", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr lockedBuffer
+	var stdoutList, stderrList []io.Writer
+	if cmd.StdOut {
+		stdoutList = append(stdoutList, &stdout)
+	}
+	if cmd.StdErr && cmd.Combine {
+		stderrList = append(stderrList, &stdout)
+	} else if cmd.StdErr {
+		stderrList = append(stderrList, &stderr)
+	}
+	if opts.Stdout != nil {
+		stdoutList = append(stdoutList, opts.Stdout)
+	}
+	if opts.Stderr != nil {
+		stderrList = append(stderrList, opts.Stderr)
+	}
+	session.Stdout = io.MultiWriter(stdoutList...)
+	session.Stderr = io.MultiWriter(stderrList...)
+	session.Stdin = opts.Stdin
+
+	command := s.setenv(session, opts.Env) + cmd.Cmd
+
+	start := time.Now()
+	err = session.Start(command)
+	if err != nil {
+		return result, fmt.Errorf("run command error: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		err = ctx.Err()
+	}
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+		result.Signal = exitErr.Signal()
+	default:
+		return result, fmt.Errorf("run command error: %w", err)
+	}
+	return result, nil
+}
+
+// names are exported unquoted in the command, so no other chars are allowed
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// setenv returns the export prefix of the command, for env rejected by the server
+func (s *SSH) setenv(session *ssh.Session, env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var prefix strings.Builder
+	for _, k := range keys {
+		if session.Setenv(k, env[k]) == nil {
+			continue
+		}
+		fmt.Fprintf(&prefix, "export %v=%v; ", k, shellQuote(env[k]))
+	}
+	return prefix.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+)
+
+func TestExec(T *testing.T) {
+	server := newTestServer(T, nil)
+	server.exec = func(cmd string, stdout, stderr io.Writer) uint32 {
+		if cmd == "sleep" {
+			time.Sleep(2 * time.Second)
+			return 0
+		}
+		fmt.Fprint(stdout, "out ")
+		fmt.Fprint(stderr, "err ")
+		fmt.Fprint(stdout, cmd)
+		return 5
+	}
+	s := server.Target()
+	defer s.Close()
+	ctx := context.Background()
+
+	result, err := s.Exec(ctx, wl_ssh.SSHCmd{Cmd: "ls", StdOut: true, StdErr: true}, nil)
+	if err != nil || result.Stdout != "out ls" || result.Stderr != "err " || result.ExitCode != 5 || result.Signal != "" {
+		T.Errorf("separate: %v, %+v", err, result)
+	}
+
+	result, err = s.Exec(ctx, *wl_ssh.NewSSHCmd("ls"), nil)
+	if err != nil || !strings.Contains(result.Stdout, "err ") || result.Stderr != "" {
+		T.Errorf("combine: %v, %+v", err, result)
+	}
+
+	var stdout, stderr bytes.Buffer
+	result, err = s.Exec(ctx, wl_ssh.SSHCmd{Cmd: "ls", StdErr: true}, &wl_ssh.ExecOptions{Stdout: &stdout, Stderr: &stderr})
+	if err != nil || result.Stdout != "" || result.Stderr != "err " || stdout.String() != "out ls" || stderr.String() != "err " {
+		T.Errorf("stream: %v, %+v, %q, %q", err, result, stdout.String(), stderr.String())
+	}
+
+	// the test server rejects env requests
+	result, err = s.Exec(ctx, wl_ssh.SSHCmd{Cmd: "ls", StdOut: true},
+		&wl_ssh.ExecOptions{Env: map[string]string{"B": "it's", "A": "1"}})
+	if err != nil || result.Stdout != `out export A='1'; export B='it'\''s'; ls` {
+		T.Errorf("env: %v, %+v", err, result)
+	}
+	for _, k := range []string{"A;touch x", "1A", "", "A=B"} {
+		result, err = s.Exec(ctx, wl_ssh.SSHCmd{Cmd: "ls", StdOut: true},
+			&wl_ssh.ExecOptions{Env: map[string]string{k: "1"}})
+		if err == nil || result.Duration != 0 {
+			T.Errorf("env name %q: %v, %+v", k, err, result)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	result, err = s.Exec(ctx, wl_ssh.SSHCmd{Cmd: "sleep"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || result.ExitCode != -1 || result.Duration > time.Second {
+		T.Errorf("cancel: %v, %+v", err, result)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build linux
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	bscerrors "github.com/wsva/lib_go/kill/errors"
+)
+
+const (
+	FleetConcurrency = 10
+)
+
+// HostResult is the result of a Fleet on one target
+type HostResult struct {
+	Host     string `json:"Host"`
+	Username string `json:"Username"`
+	//commands not run are not included
+	CmdResults []CmdResult   `json:"CmdResults"`
+	Duration   time.Duration `json:"Duration"`
+	//nil if all commands exited with 0
+	Err error `json:"-"`
+}
+
+// Fleet runs the same commands on many targets
+type Fleet struct {
+	Targets []*SSH
+	//max targets run at the same time, default FleetConcurrency
+	Concurrency int
+	//timeout of each target, including dial, 0 means no timeout
+	HostTimeout time.Duration
+	/*
+		true: stop a target at its first failed command, and cancel the others.
+		false: run all commands on all targets.
+	*/
+	FailFast bool
+}
+
+func NewFleet(targets []*SSH) *Fleet {
+	return &Fleet{
+		Targets:     targets,
+		Concurrency: FleetConcurrency,
+	}
+}
+
+/*
+Run runs cmdList on every target, one by one on each target.
+each SSHCmd is run by Exec, stdout and stderr are always captured apart,
+StdOut, StdErr and Combine of it are ignored.
+a target is dialed if its Client is nil, and closed after.
+
+results are in the order of Targets.
+the error aggregates errors of all failed targets, nil if none failed.
+*/
+func (f *Fleet) Run(ctx context.Context, cmdList []SSHCmd) ([]HostResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := f.Concurrency
+	if concurrency <= 0 {
+		concurrency = FleetConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	results := make([]HostResult, len(f.Targets))
+	var wg sync.WaitGroup
+	for i, target := range f.Targets {
+		results[i].Host = target.addr()
+		results[i].Username = target.Username
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(result *HostResult, target *SSH) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f.runHost(ctx, result, target, cmdList)
+			if result.Err != nil && f.FailFast {
+				cancel()
+			}
+		}(&results[i], target)
+	}
+	wg.Wait()
+
+	var errlist []error
+	for _, v := range results {
+		if v.Err != nil {
+			errlist = append(errlist, fmt.Errorf("%v: %w", v.Host, v.Err))
+		}
+	}
+	return results, bscerrors.NewAggregate(errlist)
+}
+
+func (f *Fleet) runHost(ctx context.Context, result *HostResult, target *SSH, cmdList []SSHCmd) {
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+	if f.HostTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.HostTimeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return
+	}
+
+	if target.Client == nil {
+		client, jumps, err := target.dial(ctx)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		target.Client = client
+		target.jumpClients = jumps
+		defer func() {
+			target.Close()
+			target.Client = nil
+		}()
+	}
+
+	var errlist []error
+	for _, v := range cmdList {
+		v.StdOut, v.StdErr, v.Combine = true, true, false
+		cmdResult, err := target.Exec(ctx, v, nil)
+		result.CmdResults = append(result.CmdResults, *cmdResult)
+		if err == nil && cmdResult.ExitCode != 0 {
+			err = fmt.Errorf("command %q exited with %v", v.Cmd, cmdResult.ExitCode)
+		}
+		if err != nil {
+			errlist = append(errlist, err)
+			if f.FailFast || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	result.Err = bscerrors.NewAggregate(errlist)
+}
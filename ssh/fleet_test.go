@@ -0,0 +1,66 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+)
+
+func TestFleet(T *testing.T) {
+	good := newTestServer(T, nil)
+	bad := newTestServer(T, nil)
+	bad.exec = func(cmd string, stdout, stderr io.Writer) uint32 {
+		if cmd == "fail" {
+			fmt.Fprint(stderr, "failed")
+			return 3
+		}
+		fmt.Fprint(stdout, cmd)
+		return 0
+	}
+	slow := newTestServer(T, nil)
+	slow.exec = func(cmd string, stdout, stderr io.Writer) uint32 {
+		time.Sleep(2 * time.Second)
+		return 0
+	}
+	target := func(s *testServer) *wl_ssh.SSH {
+		return s.Target()
+	}
+	cmdList := []wl_ssh.SSHCmd{*wl_ssh.NewSSHCmd("fail"), *wl_ssh.NewSSHCmd("echo")}
+
+	fleet := wl_ssh.NewFleet([]*wl_ssh.SSH{target(good), target(bad), target(good)})
+	results, err := fleet.Run(context.Background(), cmdList)
+	if err == nil || len(results) != 3 {
+		T.Fatalf("continue: %v, %v results", err, len(results))
+	}
+	if results[0].Err != nil || len(results[0].CmdResults) != 2 || results[0].CmdResults[0].Stdout != "fail" {
+		T.Errorf("good host: %+v", results[0])
+	}
+	r := results[1]
+	if r.Err == nil || len(r.CmdResults) != 2 || r.CmdResults[0].ExitCode != 3 ||
+		r.CmdResults[0].Stderr != "failed" || r.CmdResults[0].Stdout != "" || r.CmdResults[1].Stdout != "echo" {
+		T.Errorf("bad host: %+v", r)
+	}
+
+	fleet.FailFast = true
+	fleet.Concurrency = 1
+	fleet.Targets = []*wl_ssh.SSH{target(bad), target(good)}
+	results, err = fleet.Run(context.Background(), cmdList)
+	if err == nil || len(results[0].CmdResults) != 1 || !errors.Is(results[1].Err, context.Canceled) {
+		T.Errorf("fail fast: %v, %+v", err, results)
+	}
+
+	fleet = wl_ssh.NewFleet([]*wl_ssh.SSH{target(slow), target(good)})
+	fleet.HostTimeout = 200 * time.Millisecond
+	start := time.Now()
+	results, _ = fleet.Run(context.Background(), cmdList)
+	if time.Since(start) > time.Second || !errors.Is(results[0].Err, context.DeadlineExceeded) || results[1].Err != nil {
+		T.Errorf("host timeout: %v, %+v", time.Since(start), results)
+	}
+}
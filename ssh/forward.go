@@ -0,0 +1,386 @@
+//go:build linux
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wsva/lib_go/tcp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	ForwardLocal   = "local"
+	ForwardRemote  = "remote"
+	ForwardDynamic = "dynamic"
+)
+
+/*
+Forward is a running port forwarding, closed by Close.
+Close of SSH does not close it, but its connections fail after.
+*/
+type Forward struct {
+	//ForwardLocal, ForwardRemote or ForwardDynamic
+	Type string
+	//empty for ForwardDynamic
+	TargetAddr string
+
+	listener net.Listener
+	dial     func(addr string) (net.Conn, error)
+
+	active atomic.Int64
+	total  atomic.Int64
+	failed atomic.Int64
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	// the error stopping accepting before Close, returned by Close
+	acceptErr error
+	wg        sync.WaitGroup
+}
+
+/*
+LocalForward listens on localAddr, like "127.0.0.1:0",
+and forwards connections to remoteAddr through s, like ssh -L.
+*/
+func (s *SSH) LocalForward(localAddr, remoteAddr string) (*Forward, error) {
+	client, err := s.forwardClient()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := tcp.Listen(localAddr)
+	if err != nil {
+		return nil, err
+	}
+	f := newForward(ForwardLocal, remoteAddr, listener, sshDialer(client))
+	go f.serve(f.forward)
+	return f, nil
+}
+
+/*
+RemoteForward listens on remoteAddr of the server,
+and forwards connections to localAddr, like ssh -R.
+the server may only allow remote listening on loopback, see GatewayPorts of sshd.
+*/
+func (s *SSH) RemoteForward(remoteAddr, localAddr string) (*Forward, error) {
+	client, err := s.forwardClient()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	dial := func(addr string) (net.Conn, error) {
+		return tcp.Dial(addr)
+	}
+	f := newForward(ForwardRemote, localAddr, listener, dial)
+	go f.serve(f.forward)
+	return f, nil
+}
+
+/*
+DynamicForward runs a SOCKS5 proxy on localAddr, connecting through s, like ssh -D.
+only CONNECT without authentication is supported.
+*/
+func (s *SSH) DynamicForward(localAddr string) (*Forward, error) {
+	client, err := s.forwardClient()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := tcp.Listen(localAddr)
+	if err != nil {
+		return nil, err
+	}
+	f := newForward(ForwardDynamic, "", listener, sshDialer(client))
+	go f.serve(f.socks5)
+	return f, nil
+}
+
+func (s *SSH) forwardClient() (*ssh.Client, error) {
+	if s.Client == nil {
+		err := s.Dial()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.Client, nil
+}
+
+func sshDialer(client *ssh.Client) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		return client.Dial("tcp", addr)
+	}
+}
+
+func newForward(typ, target string, listener net.Listener, dial func(addr string) (net.Conn, error)) *Forward {
+	return &Forward{
+		Type:       typ,
+		TargetAddr: target,
+		listener:   listener,
+		dial:       dial,
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+// Addr is the listening address, with the real port if listened on port 0
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Active is the number of open connections
+func (f *Forward) Active() int64 {
+	return f.active.Load()
+}
+
+// Total is the number of accepted connections
+func (f *Forward) Total() int64 {
+	return f.total.Load()
+}
+
+// Failed is the number of connections failed to reach the target
+func (f *Forward) Failed() int64 {
+	return f.failed.Load()
+}
+
+/*
+Close stops listening, closes open connections and waits for them.
+it returns the error if accepting stopped before, like the ssh connection is lost.
+*/
+func (f *Forward) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.listener.Close()
+	if f.acceptErr != nil {
+		err = f.acceptErr
+	}
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+// serve retries temporary errors of Accept like net/http, such as too many open files
+func (f *Forward) serve(handle func(conn net.Conn)) {
+	var delay time.Duration
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			f.mu.Lock()
+			closed := f.closed
+			f.mu.Unlock()
+			if closed {
+				return
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			f.mu.Lock()
+			f.acceptErr = err
+			f.mu.Unlock()
+			return
+		}
+		delay = 0
+		if !f.track(conn) {
+			conn.Close()
+			return
+		}
+		f.total.Add(1)
+		f.active.Add(1)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer f.active.Add(-1)
+			handle(conn)
+			f.untrack(conn)
+			conn.Close()
+		}()
+	}
+}
+
+// track returns false if f is closed
+func (f *Forward) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *Forward) untrack(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+}
+
+func (f *Forward) forward(conn net.Conn) {
+	target, err := f.dial(f.TargetAddr)
+	if err != nil {
+		f.failed.Add(1)
+		return
+	}
+	f.pipe(conn, target)
+}
+
+// pipe copies between a and b until both directions are done
+func (f *Forward) pipe(a, b net.Conn) {
+	if !f.track(b) {
+		b.Close()
+		return
+	}
+	defer f.untrack(b)
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+	b.Close()
+}
+
+const (
+	socks5Version      = 5
+	socks5NoAuth       = 0
+	socks5NoAcceptable = 0xff
+	socks5Connect      = 1
+	socks5IPv4         = 1
+	socks5Domain       = 3
+	socks5IPv6         = 4
+
+	socks5Succeeded        = 0
+	socks5HostUnreachable  = 4
+	socks5CmdNotSupported  = 7
+	socks5AddrNotSupported = 8
+
+	// a client not finishing the handshake in time is closed
+	socks5HandshakeTimeout = 10 * time.Second
+)
+
+var errSocks5 = errors.New("invalid socks5 request")
+
+// socks5Reply replies with bound address 0.0.0.0:0
+func socks5Reply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socks5Version, code, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func (f *Forward) socks5(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	addr, err := socks5Handshake(conn)
+	if err != nil {
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+	target, err := f.dial(addr)
+	if err != nil {
+		f.failed.Add(1)
+		socks5Reply(conn, socks5HostUnreachable)
+		return
+	}
+	err = socks5Reply(conn, socks5Succeeded)
+	if err != nil {
+		target.Close()
+		return
+	}
+	f.pipe(conn, target)
+}
+
+// socks5Handshake returns the address to CONNECT
+func socks5Handshake(conn net.Conn) (string, error) {
+	// the longest part is 2 bytes and 255 methods
+	buf := make([]byte, 2+255)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	if buf[0] != socks5Version {
+		return "", errSocks5
+	}
+	methods := buf[2 : 2+int(buf[1])]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	noAuth := false
+	for _, v := range methods {
+		noAuth = noAuth || v == socks5NoAuth
+	}
+	if !noAuth {
+		conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return "", errSocks5
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return "", err
+	}
+
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return "", err
+	}
+	if buf[0] != socks5Version {
+		return "", errSocks5
+	}
+	if buf[1] != socks5Connect {
+		socks5Reply(conn, socks5CmdNotSupported)
+		return "", errSocks5
+	}
+	var host string
+	switch buf[3] {
+	case socks5IPv4, socks5IPv6:
+		ip := make(net.IP, net.IPv4len)
+		if buf[3] == socks5IPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5Domain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return "", err
+		}
+		domain := buf[1 : 1+int(buf[0])]
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		socks5Reply(conn, socks5AddrNotSupported)
+		return "", errSocks5
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
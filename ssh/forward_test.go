@@ -0,0 +1,150 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+)
+
+// newEchoServer echoes each line with a prefix
+func newEchoServer(T *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		T.Fatal(err)
+	}
+	T.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					fmt.Fprintf(conn, "echo %v\n", scanner.Text())
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func echo(T *testing.T, conn net.Conn, line string) {
+	T.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintln(conn, line)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || reply != "echo "+line+"\n" {
+		T.Errorf("echo %v: %q, %v", line, reply, err)
+	}
+}
+
+func waitActive(T *testing.T, f *wl_ssh.Forward, active int64) {
+	T.Helper()
+	for i := 0; i < 100 && f.Active() != active; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f.Active() != active {
+		T.Errorf("active %v, want %v", f.Active(), active)
+	}
+}
+
+func TestForward(T *testing.T) {
+	server := newTestServer(T, nil)
+	echoAddr := newEchoServer(T)
+	s := server.Target()
+	defer s.Close()
+
+	local, err := s.LocalForward("127.0.0.1:0", echoAddr)
+	if err != nil {
+		T.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", local.Addr().String())
+		if err != nil {
+			T.Fatal(err)
+		}
+		echo(T, conn, "local")
+		conn.Close()
+	}
+	waitActive(T, local, 0)
+	if local.Total() != 2 || local.Failed() != 0 {
+		T.Errorf("local total %v, failed %v", local.Total(), local.Failed())
+	}
+	conn, err := net.Dial("tcp", local.Addr().String())
+	if err != nil {
+		T.Fatal(err)
+	}
+	echo(T, conn, "open")
+	waitActive(T, local, 1)
+	local.Close()
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		T.Errorf("open connection should be closed: %v", err)
+	}
+	if _, err := net.Dial("tcp", local.Addr().String()); err == nil {
+		T.Error("closed forward should not listen")
+	}
+
+	remote, err := s.RemoteForward("127.0.0.1:0", echoAddr)
+	if err != nil {
+		T.Fatal(err)
+	}
+	conn, err = net.Dial("tcp", remote.Addr().String())
+	if err != nil {
+		T.Fatal(err)
+	}
+	echo(T, conn, "remote")
+	conn.Close()
+	remote.Close()
+	if remote.Total() != 1 {
+		T.Errorf("remote total %v", remote.Total())
+	}
+
+	dynamic, err := s.DynamicForward("127.0.0.1:0")
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer dynamic.Close()
+	socks := func(host string, port int) (net.Conn, byte) {
+		conn, err := net.Dial("tcp", dynamic.Addr().String())
+		if err != nil {
+			T.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte{5, 1, 0})
+		reply := make([]byte, 10)
+		if _, err := io.ReadFull(conn, reply[:2]); err != nil || reply[1] != 0 {
+			T.Fatalf("socks5 method: %v, %v", reply[:2], err)
+		}
+		request := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+		request = binary.BigEndian.AppendUint16(request, uint16(port))
+		conn.Write(request)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			T.Fatal(err)
+		}
+		return conn, reply[1]
+	}
+	host, portString, _ := net.SplitHostPort(echoAddr)
+	var port int
+	fmt.Sscan(portString, &port)
+	conn, code := socks(host, port)
+	if code != 0 {
+		T.Fatalf("socks5 connect: %v", code)
+	}
+	echo(T, conn, "dynamic")
+	conn.Close()
+	_, code = socks("127.0.0.1", 1)
+	if code == 0 || dynamic.Failed() != 1 {
+		T.Errorf("socks5 unreachable: %v, failed %v", code, dynamic.Failed())
+	}
+}
@@ -0,0 +1,202 @@
+//go:build linux
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// values of SSH.HostKeyPolicy
+const (
+	// the key must be in KnownHostsFile or HostKeyFingerprints
+	HostKeyStrict = "strict"
+	// trust on first use, unknown keys are added to KnownHostsFile or DefaultKnownHostsFile
+	HostKeyTOFU = "tofu"
+	// no checking, vulnerable to MITM, it must be set explicitly
+	HostKeyInsecure = "insecure"
+)
+
+// used if neither KnownHostsFile nor HostKeyFingerprints is set, like OpenSSH
+const DefaultKnownHostsFile = "~/.ssh/known_hosts"
+
+/*
+HostKeyError is returned by Dial if the host key is not trusted.
+Unknown is true if no key is known for the host,
+otherwise the key has changed, which may be a MITM attack.
+*/
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Want        []string
+	Unknown     bool
+}
+
+func (e *HostKeyError) Error() string {
+	if e.Unknown {
+		return fmt.Sprintf("unknown host key for %v: %v", e.Host, e.Fingerprint)
+	}
+	return fmt.Sprintf("host key mismatch for %v: got %v, want %v",
+		e.Host, e.Fingerprint, strings.Join(e.Want, ", "))
+}
+
+// appending to known_hosts files
+var knownHostsLock sync.Mutex
+
+func (s *SSH) hostKeyPolicy() string {
+	if s.HostKeyPolicy != "" {
+		return s.HostKeyPolicy
+	}
+	return HostKeyStrict
+}
+
+func (s *SSH) knownHostsFile() string {
+	filename := s.KnownHostsFile
+	if filename == "" && len(s.HostKeyFingerprints) == 0 {
+		filename = DefaultKnownHostsFile
+	}
+	if strings.HasPrefix(filename, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, filename[2:])
+		}
+	}
+	return filename
+}
+
+// loadKnownHosts returns nil if the file does not exist
+func (s *SSH) loadKnownHosts() (ssh.HostKeyCallback, error) {
+	filename := s.knownHostsFile()
+	if filename == "" {
+		return nil, nil
+	}
+	_, err := os.Stat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return knownhosts.New(filename)
+}
+
+func (s *SSH) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	policy := s.hostKeyPolicy()
+	switch policy {
+	case HostKeyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil
+	case HostKeyStrict, HostKeyTOFU:
+	default:
+		return nil, fmt.Errorf("unknown host key policy: %v", policy)
+	}
+	known, err := s.loadKnownHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		for _, v := range s.HostKeyFingerprints {
+			if v == fingerprint || v == ssh.FingerprintLegacyMD5(key) {
+				return nil
+			}
+		}
+		var want []string
+		want = append(want, s.HostKeyFingerprints...)
+		if known != nil {
+			err := known(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+			var ke *knownhosts.KeyError
+			if !errors.As(err, &ke) {
+				return err
+			}
+			for _, v := range ke.Want {
+				want = append(want, ssh.FingerprintSHA256(v.Key))
+			}
+		}
+		if len(want) > 0 {
+			return &HostKeyError{Host: hostname, Fingerprint: fingerprint, Want: want}
+		}
+		if policy == HostKeyTOFU {
+			return s.addKnownHost(hostname, key)
+		}
+		return &HostKeyError{Host: hostname, Fingerprint: fingerprint, Unknown: true}
+	}, nil
+}
+
+func (s *SSH) addKnownHost(hostname string, key ssh.PublicKey) error {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+	filename := s.knownHostsFile()
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(knownhosts.Line([]string{hostname}, key) + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+hostKeyAlgorithms returns the algorithms of keys known for addr,
+so the server presents a key that can be checked,
+nil to use the default of x/crypto.
+*/
+func (s *SSH) hostKeyAlgorithms(addr string) []string {
+	if s.hostKeyPolicy() == HostKeyInsecure {
+		return nil
+	}
+	known, err := s.loadKnownHosts()
+	if known == nil || err != nil {
+		return nil
+	}
+	// a key that is never known, to get the known keys from KeyError
+	probe, err := newProbeKey()
+	if err != nil {
+		return nil
+	}
+	var ke *knownhosts.KeyError
+	if !errors.As(known(addr, &net.TCPAddr{}, probe), &ke) {
+		return nil
+	}
+	var result []string
+	for _, v := range ke.Want {
+		if v.Key.Type() == ssh.KeyAlgoRSA {
+			result = append(result, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		result = append(result, v.Key.Type())
+	}
+	return result
+}
+
+var (
+	probeKey     ssh.PublicKey
+	probeKeyErr  error
+	probeKeyOnce sync.Once
+)
+
+func newProbeKey() (ssh.PublicKey, error) {
+	probeKeyOnce.Do(func() {
+		public, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			probeKeyErr = err
+			return
+		}
+		probeKey, probeKeyErr = ssh.NewPublicKey(public)
+	})
+	return probeKey, probeKeyErr
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestHostKey(T *testing.T) {
+	server := newTestServer(T, nil)
+	_, otherKey := newTestSigner(T)
+	dir := T.TempDir()
+	addr := net.JoinHostPort(server.Host, server.Port)
+
+	knownFile := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownFile, []byte(knownhosts.Line([]string{addr}, server.HostKey.PublicKey())+"\n"), 0600)
+	changedFile := filepath.Join(dir, "known_hosts_changed")
+	os.WriteFile(changedFile, []byte(knownhosts.Line([]string{addr}, otherKey.PublicKey())+"\n"), 0600)
+	tofuFile := filepath.Join(dir, "tofu", "known_hosts")
+
+	dial := func(s wl_ssh.SSH) error {
+		s.IP, s.Port, s.Username, s.Password = server.Host, server.Port, "username", "password"
+		err := s.Dial()
+		if err == nil {
+			s.Close()
+		}
+		return err
+	}
+	hostKeyError := func(err error) *wl_ssh.HostKeyError {
+		var e *wl_ssh.HostKeyError
+		if !errors.As(err, &e) {
+			T.Fatalf("expected HostKeyError, got %v", err)
+		}
+		return e
+	}
+
+	T.Setenv("HOME", dir)
+	if !hostKeyError(dial(wl_ssh.SSH{})).Unknown {
+		T.Error("strict by default")
+	}
+	if err := dial(wl_ssh.SSH{HostKeyPolicy: wl_ssh.HostKeyInsecure}); err != nil {
+		T.Errorf("insecure: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dir, ".ssh"), 0700)
+	os.WriteFile(filepath.Join(dir, ".ssh", "known_hosts"), []byte(knownhosts.Line([]string{addr}, server.HostKey.PublicKey())+"\n"), 0600)
+	if err := dial(wl_ssh.SSH{}); err != nil {
+		T.Errorf("default known_hosts: %v", err)
+	}
+	if err := dial(wl_ssh.SSH{KnownHostsFile: knownFile}); err != nil {
+		T.Errorf("known host: %v", err)
+	}
+	e := hostKeyError(dial(wl_ssh.SSH{KnownHostsFile: changedFile}))
+	if e.Unknown || e.Fingerprint != ssh.FingerprintSHA256(server.HostKey.PublicKey()) ||
+		len(e.Want) != 1 || e.Want[0] != ssh.FingerprintSHA256(otherKey.PublicKey()) {
+		T.Errorf("mismatch: %+v", e)
+	}
+	e = hostKeyError(dial(wl_ssh.SSH{KnownHostsFile: tofuFile, HostKeyPolicy: wl_ssh.HostKeyStrict}))
+	if !e.Unknown {
+		T.Errorf("unknown: %+v", e)
+	}
+
+	if err := dial(wl_ssh.SSH{HostKeyFingerprints: []string{ssh.FingerprintSHA256(server.HostKey.PublicKey())}}); err != nil {
+		T.Errorf("pinned: %v", err)
+	}
+	if err := dial(wl_ssh.SSH{HostKeyFingerprints: []string{ssh.FingerprintLegacyMD5(server.HostKey.PublicKey())}}); err != nil {
+		T.Errorf("pinned md5: %v", err)
+	}
+	hostKeyError(dial(wl_ssh.SSH{HostKeyFingerprints: []string{ssh.FingerprintSHA256(otherKey.PublicKey())}}))
+
+	for i := 0; i < 2; i++ {
+		if err := dial(wl_ssh.SSH{KnownHostsFile: tofuFile, HostKeyPolicy: wl_ssh.HostKeyTOFU}); err != nil {
+			T.Errorf("tofu %v: %v", i, err)
+		}
+	}
+	content, _ := os.ReadFile(tofuFile)
+	if strings.Count(string(content), "\n") != 1 {
+		T.Errorf("tofu should record the key once:\n%s", content)
+	}
+	if err := dial(wl_ssh.SSH{KnownHostsFile: tofuFile}); err != nil {
+		T.Errorf("recorded key: %v", err)
+	}
+	hostKeyError(dial(wl_ssh.SSH{KnownHostsFile: changedFile, HostKeyPolicy: wl_ssh.HostKeyTOFU}))
+
+	// tofu records to the default file
+	home := filepath.Join(dir, "home")
+	T.Setenv("HOME", home)
+	if err := dial(wl_ssh.SSH{HostKeyPolicy: wl_ssh.HostKeyTOFU}); err != nil {
+		T.Errorf("tofu default file: %v", err)
+	}
+	content, _ = os.ReadFile(filepath.Join(home, ".ssh", "known_hosts"))
+	if strings.Count(string(content), "\n") != 1 {
+		T.Errorf("tofu should record the key to the default file:\n%s", content)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+dial connects to s through s.JumpHosts in order, like ProxyJump of OpenSSH.
+each jump host uses its own credentials and host key settings,
+JumpHosts of jump hosts are ignored.
+the returned jump clients must be closed after the client.
+*/
+func (s *SSH) dial(ctx context.Context) (*ssh.Client, []*ssh.Client, error) {
+	var jumps []*ssh.Client
+	var prev *ssh.Client
+	for _, v := range s.JumpHosts {
+		client, err := v.dialVia(ctx, prev)
+		if err != nil {
+			closeClients(jumps)
+			return nil, nil, fmt.Errorf("dial jump host %v error: %w", v.addr(), err)
+		}
+		jumps = append(jumps, client)
+		prev = client
+	}
+	client, err := s.dialVia(ctx, prev)
+	if err != nil {
+		closeClients(jumps)
+		return nil, nil, err
+	}
+	return client, jumps, nil
+}
+
+// dialVia dials s directly if prev is nil
+func (s *SSH) dialVia(ctx context.Context, prev *ssh.Client) (*ssh.Client, error) {
+	config, closer, err := s.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	addr := s.addr()
+	var conn net.Conn
+	if prev == nil {
+		d := net.Dialer{Timeout: config.Timeout}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = prev.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// channels of jump hosts have no deadline, so the conn is closed on timeout
+	timeout := config.Timeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout == 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+	}
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { conn.Close() })
+		defer timer.Stop()
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, errors.Join(ctx.Err(), err)
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+)
+
+func TestJumpHosts(T *testing.T) {
+	jump1 := newTestServer(T, nil)
+	jump2 := newTestServer(T, nil)
+	target := newTestServer(T, nil)
+	config := wl_ssh.DefaultSSHConfig()
+	config.TimeoutSpawn = 5 * time.Second
+
+	s := wl_ssh.SSH{
+		IP:       target.Host,
+		Port:     target.Port,
+		Username: "username",
+		Password: "password",
+		JumpHosts: []*wl_ssh.SSH{
+			{IP: jump1.Host, Port: jump1.Port, Username: "username", Password: "password",
+				HostKeyFingerprints: []string{fingerprint(jump1)}},
+			{IP: jump2.Host, Port: jump2.Port, Username: "username", Password: "password",
+				HostKeyPolicy: wl_ssh.HostKeyStrict, HostKeyFingerprints: []string{fingerprint(jump2)}},
+		},
+		HostKeyFingerprints: []string{fingerprint(target)},
+		SSHConfig:           config,
+	}
+	defer s.Close()
+
+	output, err := s.ExecV01("whoami")
+	if err != nil || output != "whoami" {
+		T.Fatalf("exec 01: %q %v", output, err)
+	}
+	if jump1.Forwarded.Load() != 1 || jump2.Forwarded.Load() != 1 {
+		T.Errorf("not dialed through jump hosts: %v %v", jump1.Forwarded.Load(), jump2.Forwarded.Load())
+	}
+	output, err = s.ExecV02([]string{"whoami"})
+	if err != nil || output != "whoami\n" {
+		T.Errorf("exec 02: %q %v", output, err)
+	}
+	cmd := *wl_ssh.NewSSHCmd("whoami")
+	cmd.Timeout = 5 * time.Second
+	output, _, err = s.ExecV03([]wl_ssh.SSHCmd{cmd}, true)
+	if err != nil || !strings.Contains(output, "whoami") {
+		T.Errorf("exec 03: %q %v", output, err)
+	}
+	su := wl_ssh.NewSSHSuTo("root", "password")
+	su.Timeout = 5 * time.Second
+	output, _, err = s.ExecV04(su, []wl_ssh.SSHCmd{cmd}, true)
+	if err != nil || !strings.Contains(output, "whoami") {
+		T.Errorf("exec 04: %q %v", output, err)
+	}
+
+	bad := target.Target()
+	bad.JumpHosts = []*wl_ssh.SSH{{IP: jump1.Host, Port: jump1.Port, Username: "username", Password: "wrong",
+		HostKeyFingerprints: []string{fingerprint(jump1)}}}
+	err = bad.Dial()
+	if err == nil || !strings.Contains(err.Error(), "jump host "+jump1.Addr()) {
+		T.Errorf("wrong jump password: %v", err)
+	}
+}
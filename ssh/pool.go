@@ -0,0 +1,315 @@
+//go:build linux
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	//default MaxSessions of sshd
+	PoolMaxSessions = 10
+	PoolKeepAlive   = 30 * time.Second
+	PoolIdleTimeout = 5 * time.Minute
+)
+
+var ErrPoolClosed = errors.New("ssh pool closed")
+
+/*
+Pool shares connections by Username, IP and Port of targets.
+dead connections are dropped, when closed or keepalive fails,
+and new ones are dialed by Acquire.
+fields can be changed before the first Acquire.
+*/
+type Pool struct {
+	//sessions per connection, more connections are dialed if all are full
+	MaxSessions int
+	//interval of keepalive requests, also the timeout of them, <=0 disables.
+	//a connection is not pinged again while a request is in flight
+	KeepAlive time.Duration
+	//connections without sessions for it are closed, checked at the same interval, <=0 disables
+	IdleTimeout time.Duration
+
+	mu      sync.Mutex
+	conns   map[string][]*poolConn
+	closed  bool
+	started bool
+	stop    chan struct{}
+}
+
+type poolConn struct {
+	key      string
+	client   *ssh.Client
+	jumps    []*ssh.Client
+	sessions int
+	lastUsed time.Time
+	dead     bool
+	pinging  bool
+}
+
+func NewPool() *Pool {
+	return &Pool{
+		MaxSessions: PoolMaxSessions,
+		KeepAlive:   PoolKeepAlive,
+		IdleTimeout: PoolIdleTimeout,
+		conns:       make(map[string][]*poolConn),
+		stop:        make(chan struct{}),
+	}
+}
+
+func poolKey(target *SSH) string {
+	return target.Username + "@" + target.addr()
+}
+
+/*
+Acquire returns a copy of target using a pooled connection, which takes one session.
+release must be called after, and the copy must not be closed.
+the copy should run one session at a time, like Exec, ExecV03 or SFTP.
+*/
+func (p *Pool) Acquire(ctx context.Context, target *SSH) (s *SSH, release func(), err error) {
+	pc, err := p.acquire(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, release = p.bind(target, pc)
+	return s, release, nil
+}
+
+/*
+Exec runs cmd by Exec of a pooled connection.
+it is retried once on a new connection,
+if the connection is found broken before the command is started.
+*/
+func (p *Pool) Exec(ctx context.Context, target *SSH, cmd SSHCmd, opts *ExecOptions) (*CmdResult, error) {
+	for i := 0; ; i++ {
+		pc, err := p.acquire(ctx, target)
+		if err != nil {
+			return &CmdResult{Cmd: cmd.Cmd, ExitCode: -1}, err
+		}
+		s, release := p.bind(target, pc)
+		result, err := s.Exec(ctx, cmd, opts)
+		release()
+		var openErr *ssh.OpenChannelError
+		if err == nil || i > 0 || result.Duration > 0 || ctx.Err() != nil || errors.As(err, &openErr) {
+			return result, err
+		}
+		p.drop(pc)
+	}
+}
+
+// Len is the number of open connections
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	count := 0
+	for _, v := range p.conns {
+		count += len(v)
+	}
+	return count
+}
+
+// Close closes all connections, sessions in use fail after
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+	var all []*poolConn
+	for _, v := range p.conns {
+		all = append(all, v...)
+	}
+	p.mu.Unlock()
+	for _, v := range all {
+		p.drop(v)
+	}
+	return nil
+}
+
+func (p *Pool) acquire(ctx context.Context, target *SSH) (*poolConn, error) {
+	key := poolKey(target)
+	max := p.MaxSessions
+	if max <= 0 {
+		max = PoolMaxSessions
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if !p.started {
+		p.started = true
+		go p.maintain()
+	}
+	for _, v := range p.conns[key] {
+		if v.sessions < max {
+			v.sessions++
+			v.lastUsed = time.Now()
+			p.mu.Unlock()
+			return v, nil
+		}
+	}
+	p.mu.Unlock()
+
+	client, jumps, err := target.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pc := &poolConn{
+		key:      key,
+		client:   client,
+		jumps:    jumps,
+		sessions: 1,
+		lastUsed: time.Now(),
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		client.Close()
+		closeClients(jumps)
+		return nil, ErrPoolClosed
+	}
+	p.conns[key] = append(p.conns[key], pc)
+	p.mu.Unlock()
+	go func() {
+		client.Wait()
+		p.drop(pc)
+	}()
+	return pc, nil
+}
+
+func (p *Pool) bind(target *SSH, pc *poolConn) (*SSH, func()) {
+	s := *target
+	s.Client = pc.client
+	s.jumpClients = nil
+	s.sftpClient = nil
+	var once sync.Once
+	return &s, func() {
+		once.Do(func() {
+			if s.sftpClient != nil {
+				s.sftpClient.Close()
+				s.sftpClient = nil
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			pc.sessions--
+			pc.lastUsed = time.Now()
+		})
+	}
+}
+
+// drop removes pc from the pool and closes it
+func (p *Pool) drop(pc *poolConn) {
+	p.mu.Lock()
+	if pc.dead {
+		p.mu.Unlock()
+		return
+	}
+	pc.dead = true
+	list := p.conns[pc.key]
+	for i, v := range list {
+		if v == pc {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(p.conns, pc.key)
+	} else {
+		p.conns[pc.key] = list
+	}
+	p.mu.Unlock()
+	pc.client.Close()
+	closeClients(pc.jumps)
+}
+
+// maintain closes idle connections and sends keepalive requests, each at its own interval
+func (p *Pool) maintain() {
+	var keepAliveC, idleC <-chan time.Time
+	if p.KeepAlive > 0 {
+		ticker := time.NewTicker(p.KeepAlive)
+		defer ticker.Stop()
+		keepAliveC = ticker.C
+	}
+	if p.IdleTimeout > 0 {
+		ticker := time.NewTicker(p.IdleTimeout)
+		defer ticker.Stop()
+		idleC = ticker.C
+	}
+	if keepAliveC == nil && idleC == nil {
+		return
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-keepAliveC:
+			p.keepAliveAll()
+		case <-idleC:
+			p.closeIdle()
+		}
+	}
+}
+
+func (p *Pool) closeIdle() {
+	var idle []*poolConn
+	p.mu.Lock()
+	for _, list := range p.conns {
+		for _, v := range list {
+			if v.sessions == 0 && time.Since(v.lastUsed) >= p.IdleTimeout {
+				idle = append(idle, v)
+			}
+		}
+	}
+	p.mu.Unlock()
+	for _, v := range idle {
+		p.drop(v)
+	}
+}
+
+// keepAliveAll pings connections without a keepalive request in flight
+func (p *Pool) keepAliveAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, list := range p.conns {
+		for _, v := range list {
+			if v.pinging {
+				continue
+			}
+			v.pinging = true
+			go p.keepAlive(v)
+		}
+	}
+}
+
+// keepAlive drops pc if the server does not reply in time
+func (p *Pool) keepAlive(pc *poolConn) {
+	defer func() {
+		p.mu.Lock()
+		pc.pinging = false
+		p.mu.Unlock()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		//any reply means alive, most servers reply false
+		_, _, err := pc.client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	timer := time.NewTimer(p.KeepAlive)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			p.drop(pc)
+		}
+	case <-timer.C:
+		p.drop(pc)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	wl_ssh "github.com/wsva/lib_go/ssh"
+)
+
+func waitPoolLen(T *testing.T, pool *wl_ssh.Pool, n int) {
+	T.Helper()
+	for i := 0; i < 100 && pool.Len() != n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pool.Len() != n {
+		T.Errorf("pool len %v, want %v", pool.Len(), n)
+	}
+}
+
+func TestPool(T *testing.T) {
+	server := newTestServer(T, nil)
+	target := server.Target()
+	ctx := context.Background()
+
+	pool := wl_ssh.NewPool()
+	pool.MaxSessions = 2
+	pool.KeepAlive = 20 * time.Millisecond
+	pool.IdleTimeout = 200 * time.Millisecond
+	defer pool.Close()
+
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		s, release, err := pool.Acquire(ctx, target)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if result, err := s.Exec(ctx, wl_ssh.SSHCmd{Cmd: "ls", StdOut: true}, nil); err != nil || result.Stdout != "ls" {
+			T.Errorf("exec %v: %v, %+v", i, err, result)
+		}
+		releases = append(releases, release)
+	}
+	if pool.Len() != 2 || server.Accepted.Load() != 2 {
+		T.Errorf("max sessions: len %v, accepted %v", pool.Len(), server.Accepted.Load())
+	}
+	for _, release := range releases {
+		release()
+	}
+	if target.Client != nil {
+		T.Error("target should not be changed")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if server.KeepAlives.Load() == 0 {
+		T.Error("no keepalive")
+	}
+	waitPoolLen(T, pool, 0)
+
+	result, err := pool.Exec(ctx, target, wl_ssh.SSHCmd{Cmd: "ls", StdOut: true}, nil)
+	if err != nil || result.Stdout != "ls" || pool.Len() != 1 {
+		T.Errorf("redial after idle: %v, %+v, len %v", err, result, pool.Len())
+	}
+	server.DropConns()
+	result, err = pool.Exec(ctx, target, wl_ssh.SSHCmd{Cmd: "ls", StdOut: true}, nil)
+	if err != nil || result.Stdout != "ls" {
+		T.Errorf("reconnect: %v, %+v", err, result)
+	}
+	waitPoolLen(T, pool, 1)
+
+	pool.Close()
+	if _, _, err := pool.Acquire(ctx, target); err != wl_ssh.ErrPoolClosed {
+		T.Errorf("closed pool: %v", err)
+	}
+	waitPoolLen(T, pool, 0)
+}
+
+func TestPoolKeepAlive(T *testing.T) {
+	server := newTestServer(T, nil)
+	ctx := context.Background()
+
+	pool := wl_ssh.NewPool()
+	pool.KeepAlive = 100 * time.Millisecond
+	pool.IdleTimeout = 10 * time.Millisecond
+	defer pool.Close()
+
+	_, release, err := pool.Acquire(ctx, server.Target())
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer release()
+	time.Sleep(250 * time.Millisecond)
+	// keepalive ticks at KeepAlive, not at the shorter IdleTimeout
+	if n := server.KeepAlives.Load(); n < 1 || n > 3 {
+		T.Errorf("keepalives: %v", n)
+	}
+	if pool.Len() != 1 {
+		T.Errorf("connection in use closed: len %v", pool.Len())
+	}
+}
@@ -0,0 +1,322 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	wl_ssh "github.com/wsva/lib_go/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process ssh server, exec echoes the command by default
+type testServer struct {
+	Host    string
+	Port    string
+	HostKey ssh.Signer
+
+	// number of forwarded connections, when used as a jump host
+	Forwarded atomic.Int32
+	// number of accepted connections and keepalive requests
+	Accepted   atomic.Int32
+	KeepAlives atomic.Int32
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	exec     func(cmd string, stdout, stderr io.Writer) uint32
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newTestSigner(T *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		T.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return key, signer
+}
+
+// newTestServer accepts user "username" with password "password" if config is nil
+func newTestServer(T *testing.T, config *ssh.ServerConfig) *testServer {
+	if config == nil {
+		config = &ssh.ServerConfig{
+			PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+				if c.User() == "username" && string(password) == "password" {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("wrong password for %v", c.User())
+			},
+		}
+	}
+	_, hostKey := newTestSigner(T)
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		T.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	s := &testServer{
+		Host:     host,
+		Port:     port,
+		HostKey:  hostKey,
+		listener: listener,
+		config:   config,
+		conns:    make(map[net.Conn]struct{}),
+		exec: func(cmd string, stdout, stderr io.Writer) uint32 {
+			fmt.Fprint(stdout, cmd)
+			return 0
+		},
+	}
+	T.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func fingerprint(s *testServer) string {
+	return ssh.FingerprintSHA256(s.HostKey.PublicKey())
+}
+
+// Target returns a client of s with the default user, trusting the host key of s
+func (s *testServer) Target() *wl_ssh.SSH {
+	return &wl_ssh.SSH{
+		IP:                  s.Host,
+		Port:                s.Port,
+		Username:            "username",
+		Password:            "password",
+		HostKeyFingerprints: []string{fingerprint(s)},
+	}
+}
+
+func (s *testServer) Addr() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.Accepted.Add(1)
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+// DropConns closes all accepted connections, like a network failure
+func (s *testServer) DropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *testServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go s.handleGlobalRequests(sconn, reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go s.handleSession(channel, requests)
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (s *testServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	pty := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			pty = true
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(true, nil)
+			status := s.exec(payload.Command, channel, channel.Stderr())
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			ssh.Unmarshal(req.Payload, &payload)
+			if payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		case "shell":
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			s.shell(channel, pty)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// shell runs each line by exec until exit, with a prompt if pty is requested
+func (s *testServer) shell(channel ssh.Channel, pty bool) {
+	prompt := func() {
+		if pty {
+			fmt.Fprint(channel, "$ ")
+		}
+	}
+	prompt()
+	scanner := bufio.NewScanner(channel)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "exit" {
+			return
+		}
+		if strings.HasPrefix(line, "LANG=en su - ") {
+			fmt.Fprint(channel, "Password: ")
+			continue
+		}
+		s.exec(line, channel, channel.Stderr())
+		fmt.Fprint(channel, "\n")
+		prompt()
+	}
+}
+
+func (s *testServer) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	ssh.Unmarshal(newChannel.ExtraData(), &payload)
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.Forwarded.Add(1)
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+	}()
+	io.Copy(conn, channel)
+	conn.Close()
+	channel.Close()
+}
+
+// handleGlobalRequests supports tcpip-forward, for remote forwarding
+func (s *testServer) handleGlobalRequests(sconn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := map[string]net.Listener{}
+	defer func() {
+		for _, v := range listeners {
+			v.Close()
+		}
+	}()
+	for req := range reqs {
+		var payload struct {
+			Addr string
+			Port uint32
+		}
+		ssh.Unmarshal(req.Payload, &payload)
+		switch req.Type {
+		case "tcpip-forward":
+			listener, err := net.Listen("tcp", net.JoinHostPort(payload.Addr, fmt.Sprint(payload.Port)))
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			_, portString, _ := net.SplitHostPort(listener.Addr().String())
+			var port uint32
+			fmt.Sscan(portString, &port)
+			listeners[fmt.Sprint(port)] = listener
+			req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			go s.acceptForwarded(sconn, listener, payload.Addr, port)
+		case "keepalive@openssh.com":
+			s.KeepAlives.Add(1)
+			req.Reply(false, nil)
+		case "cancel-tcpip-forward":
+			if listener, ok := listeners[fmt.Sprint(payload.Port)]; ok {
+				listener.Close()
+				delete(listeners, fmt.Sprint(payload.Port))
+			}
+			req.Reply(true, nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *testServer) acceptForwarded(sconn *ssh.ServerConn, listener net.Listener, addr string, port uint32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			origin := conn.RemoteAddr().(*net.TCPAddr)
+			channel, requests, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+				Addr     string
+				Port     uint32
+				OrigAddr string
+				OrigPort uint32
+			}{addr, port, origin.IP.String(), uint32(origin.Port)}))
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			go func() {
+				io.Copy(channel, conn)
+				channel.CloseWrite()
+			}()
+			io.Copy(conn, channel)
+			channel.Close()
+		}()
+	}
+}
@@ -0,0 +1,260 @@
+//go:build linux
+
+package ssh
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+)
+
+/*
+SFTPProgress is called during transfer with the bytes transferred so far,
+and the total bytes of the file.
+*/
+type SFTPProgress func(transferred, total int64)
+
+type progressWriter struct {
+	w           io.Writer
+	transferred int64
+	total       int64
+	progress    SFTPProgress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	if n > 0 {
+		p.transferred += int64(n)
+		p.progress(p.transferred, p.total)
+	}
+	return n, err
+}
+
+type progressReader struct {
+	r           io.Reader
+	transferred int64
+	total       int64
+	progress    SFTPProgress
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.transferred += int64(n)
+		p.progress(p.transferred, p.total)
+	}
+	return n, err
+}
+
+/*
+SFTP returns the sftp client over s.Client, dialed if needed.
+it is reused by the SFTP methods of s, and closed by Close.
+*/
+func (s *SSH) SFTP() (*sftp.Client, error) {
+	if s.sftpClient != nil {
+		return s.sftpClient, nil
+	}
+	if s.Client == nil {
+		err := s.Dial()
+		if err != nil {
+			return nil, err
+		}
+	}
+	client, err := sftp.NewClient(s.Client)
+	if err != nil {
+		return nil, err
+	}
+	s.sftpClient = client
+	return client, nil
+}
+
+/*
+Upload copies local file to remote, creating parent directories.
+the permission of local file is kept. progress can be nil.
+*/
+func (s *SSH) Upload(local, remote string, progress SFTPProgress) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	err = client.MkdirAll(path.Dir(remote))
+	if err != nil {
+		return err
+	}
+	dst, err := client.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = src
+	if progress != nil {
+		r = &progressReader{r: src, total: info.Size(), progress: progress}
+	}
+	_, err = dst.ReadFrom(r)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = client.Chmod(remote, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return client.Chtimes(remote, info.ModTime(), info.ModTime())
+}
+
+// Download copies remote file to local, creating parent directories. progress can be nil.
+func (s *SSH) Download(remote, local string, progress SFTPProgress) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	src, err := client.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(local), 0755)
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	var w io.Writer = dst
+	if progress != nil {
+		w = &progressWriter{w: dst, total: info.Size(), progress: progress}
+	}
+	_, err = src.WriteTo(w)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+SyncDir uploads localDir to remoteDir recursively.
+files with the same size and modification time on remote are skipped,
+remote files not in localDir are kept.
+progress is called per file, with the relative path.
+*/
+func (s *SSH) SyncDir(localDir, remoteDir string, progress func(name string, transferred, total int64)) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(remoteDir, filepath.ToSlash(rel))
+		if d.IsDir() {
+			return client.MkdirAll(remote)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		remoteInfo, err := client.Stat(remote)
+		if err == nil && remoteInfo.Size() == info.Size() &&
+			remoteInfo.ModTime().Unix() == info.ModTime().Unix() {
+			return nil
+		}
+		var fileProgress SFTPProgress
+		if progress != nil {
+			fileProgress = func(transferred, total int64) {
+				progress(rel, transferred, total)
+			}
+		}
+		return s.Upload(p, remote, fileProgress)
+	})
+}
+
+func (s *SSH) Stat(remote string) (os.FileInfo, error) {
+	client, err := s.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	return client.Stat(remote)
+}
+
+// MkdirAll works like mkdir -p
+func (s *SSH) MkdirAll(remote string) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	return client.MkdirAll(remote)
+}
+
+// Remove removes a file or an empty directory
+func (s *SSH) Remove(remote string) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	return client.Remove(remote)
+}
+
+// RemoveAll works like rm -rf, it returns nil if remote does not exist
+func (s *SSH) RemoveAll(remote string) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	_, err = client.Lstat(remote)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return client.RemoveAll(remote)
+}
+
+/*
+Rename replaces newname if the server supports posix-rename,
+otherwise it fails if newname exists.
+*/
+func (s *SSH) Rename(oldname, newname string) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	// errors of posix-rename are real, like permission denied, not to be retried
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(oldname, newname)
+	}
+	return client.Rename(oldname, newname)
+}
+
+func (s *SSH) Chmod(remote string, mode os.FileMode) error {
+	client, err := s.SFTP()
+	if err != nil {
+		return err
+	}
+	return client.Chmod(remote, mode)
+}
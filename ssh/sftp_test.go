@@ -0,0 +1,127 @@
+//go:build linux
+
+package ssh_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestSFTP(T *testing.T) {
+	server := newTestServer(T, nil)
+	s := server.Target()
+	defer s.Close()
+	local := T.TempDir()
+	remote := T.TempDir()
+
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	src := filepath.Join(local, "src.txt")
+	os.WriteFile(src, content, 0640)
+
+	var last, total int64
+	err := s.Upload(src, remote+"/a/b/file.txt", func(transferred, t int64) {
+		last, total = transferred, t
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+	if last != int64(len(content)) || total != int64(len(content)) {
+		T.Errorf("upload progress: %v/%v", last, total)
+	}
+	info, err := s.Stat(remote + "/a/b/file.txt")
+	if err != nil || info.Size() != int64(len(content)) || info.Mode().Perm() != 0640 {
+		T.Errorf("stat: %v %v", info, err)
+	}
+
+	dest := filepath.Join(local, "out", "dest.txt")
+	last = 0
+	err = s.Download(remote+"/a/b/file.txt", dest, func(transferred, t int64) { last = transferred })
+	if err != nil {
+		T.Fatal(err)
+	}
+	got, _ := os.ReadFile(dest)
+	if !bytes.Equal(got, content) || last != int64(len(content)) {
+		T.Errorf("download: %v bytes, progress %v", len(got), last)
+	}
+
+	if err := s.MkdirAll(remote + "/x/y/z"); err != nil {
+		T.Error(err)
+	}
+	if err := s.Chmod(remote+"/a/b/file.txt", 0600); err != nil {
+		T.Error(err)
+	}
+	if info, _ := os.Stat(remote + "/a/b/file.txt"); info.Mode().Perm() != 0600 {
+		T.Errorf("chmod: %v", info.Mode())
+	}
+	os.WriteFile(remote+"/x/file.txt", []byte("old"), 0644)
+	if err := s.Rename(remote+"/a/b/file.txt", remote+"/x/file.txt"); err != nil {
+		T.Error(err)
+	}
+	if content, _ := os.ReadFile(remote + "/x/file.txt"); string(content) == "old" {
+		T.Error("rename should replace the existing file")
+	}
+	if err := s.Rename(remote+"/a/b/file.txt", remote+"/x/file.txt"); !errors.Is(err, os.ErrNotExist) {
+		T.Errorf("rename missing file: %v", err)
+	}
+	if err := s.Remove(remote + "/x/file.txt"); err != nil {
+		T.Error(err)
+	}
+	if _, err := s.Stat(remote + "/x/file.txt"); !errors.Is(err, os.ErrNotExist) {
+		T.Errorf("removed file: %v", err)
+	}
+	if err := s.RemoveAll(remote + "/x"); err != nil {
+		T.Error(err)
+	}
+	if err := s.RemoveAll(remote + "/missing"); err != nil {
+		T.Error(err)
+	}
+	if _, err := os.Stat(remote + "/x"); !os.IsNotExist(err) {
+		T.Errorf("remove all: %v", err)
+	}
+}
+
+func TestSFTPSyncDir(T *testing.T) {
+	server := newTestServer(T, nil)
+	s := server.Target()
+	defer s.Close()
+	local := T.TempDir()
+	remote := filepath.Join(T.TempDir(), "sync")
+	os.MkdirAll(filepath.Join(local, "sub", "empty"), 0755)
+	os.WriteFile(filepath.Join(local, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(local, "sub", "b.txt"), []byte("b"), 0644)
+
+	sync := func() []string {
+		var names []string
+		err := s.SyncDir(local, remote, func(name string, transferred, total int64) {
+			if transferred == total {
+				names = append(names, name)
+			}
+		})
+		if err != nil {
+			T.Fatal(err)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if names := sync(); len(names) != 2 || names[0] != "a.txt" || names[1] != filepath.Join("sub", "b.txt") {
+		T.Errorf("first sync: %v", names)
+	}
+	if b, _ := os.ReadFile(filepath.Join(remote, "sub", "b.txt")); string(b) != "b" {
+		T.Errorf("synced content: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "sub", "empty")); err != nil {
+		T.Errorf("empty dir: %v", err)
+	}
+	if names := sync(); len(names) != 0 {
+		T.Errorf("unchanged files uploaded again: %v", names)
+	}
+	os.WriteFile(filepath.Join(local, "a.txt"), []byte("aa"), 0644)
+	if names := sync(); len(names) != 1 || names[0] != "a.txt" {
+		T.Errorf("changed file: %v", names)
+	}
+}